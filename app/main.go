@@ -29,11 +29,17 @@ func main() {
 	app := app.NewApp(cfg, log)
 	s, err := registerService(app)
 	if err != nil {
-		app.Run()
-		<- ctx.Done()
+		runErr := app.Run()
+		if runErr == nil {
+			<- ctx.Done()
+		}
 		shutdownContext, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
 		defer cancel()
 		app.Shutdown(shutdownContext)
+		if runErr != nil {
+			cancel()
+			os.Exit(1)
+		}
 	} else {
 		s.Run()
 	}
@@ -2,9 +2,11 @@ package app
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"time"
 
+	"github.com/behummble/29-11-2025/internal/auth"
 	"github.com/behummble/29-11-2025/internal/config"
 	"github.com/behummble/29-11-2025/internal/handlers/http"
 	"github.com/behummble/29-11-2025/internal/service"
@@ -15,24 +17,73 @@ import (
 type App struct {
 	Server *http.Server
 	Service *service.LinkService
+	storage service.Storage
 	log *slog.Logger
+	drainDelay time.Duration
+}
+
+// readiness is implemented by the components checked by /readyz.
+type readiness interface {
+	Ready() error
 }
 
 func NewApp(cfg config.Config, log *slog.Logger) *App {
-	storage := storage.NewStorage(cfg.Storage, log)
-	log.Info("Storage init")
-	service := service.NewService(storage, log)
-	server := http.NewServer(log, cfg.Server, service)
+	storage := newStorage(cfg.Storage, log)
+	log.Info("Storage init", slog.String("type", cfg.Storage.Type))
+	service, err := service.NewService(storage, cfg, log)
+	if err != nil {
+		panic("cannot init service: " + err.Error())
+	}
+	server := http.NewServer(log, cfg.Server, cfg.RateLimit, service, newAuthenticator(cfg, log))
+	if storage, ok := storage.(readiness); ok {
+		server.AddReadinessCheck("storage", storage.Ready)
+	}
+	server.AddReadinessCheck("service", service.Ready)
 	return &App{
 		log: log,
 		Server: server,
 		Service: service,
+		storage: storage,
+		drainDelay: cfg.Server.DrainDelay,
+	}
+}
+
+func newStorage(cfg config.StorageConfig, log *slog.Logger) service.Storage {
+	switch cfg.PackageIDs {
+	case "", config.PackageIDsSequential, config.PackageIDsUUIDv7:
+	default:
+		panic("unknown package IDs: " + cfg.PackageIDs)
+	}
+	switch cfg.Type {
+	case "", config.StorageMemory:
+		return storage.NewStorage(cfg, log)
+	case config.StorageDisk:
+		storage, err := storage.NewDiskStorage(cfg, log)
+		if err != nil {
+			panic("cannot open disk storage: " + err.Error())
+		}
+		return storage
+	default:
+		panic("unknown storage type: " + cfg.Type)
 	}
 }
 
+func newAuthenticator(cfg config.Config, log *slog.Logger) http.Authenticator {
+	if !cfg.Auth.Enabled {
+		if cfg.Server.Host != "localhost" && cfg.Server.Host != "127.0.0.1" {
+			log.Warn("Authentication is disabled, the API is open to every client", slog.String("host", cfg.Server.Host))
+		}
+		return nil
+	}
+	authenticator, err := auth.NewAuthenticator(cfg.Auth, log)
+	if err != nil {
+		panic("cannot init authentication: " + err.Error())
+	}
+	return authenticator
+}
+
 func(app *App) Start(svc.Service) error {
-	app.work()
-	return nil
+	return app.work()
 }
 
 func(app *App) Stop(svc.Service) error {
@@ -45,17 +96,31 @@ func(app *App) Shutdown(ctx context.Context) error {
 	return app.stopApp(ctx)
 }
 
-func(app *App) Run() {
-	app.work()
+// Run starts the app and returns once it serves, or the error of the server.
+func(app *App) Run() error {
+	return app.work()
 }
 
-func(app *App) work() {
-	go app.Server.Start()
-	app.log.Info("Server is Up")
+func(app *App) work() error {
 	go app.Service.ValidateCache()
+	if err := app.Server.Start(); err != nil {
+		app.log.Error("Error while starting server", slog.String("error", err.Error()))
+		return err
+	}
+	app.log.Info("Server is Up")
+	return nil
 }
 
 func(app *App) stopApp(ctx context.Context) error {
+	app.Server.Drain()
+	if app.drainDelay > 0 {
+		app.log.Info("Draining server", slog.Duration("delay", app.drainDelay))
+		select {
+		case <- time.After(app.drainDelay):
+		case <- ctx.Done():
+		}
+	}
+
 	err := app.Server.Shutdown(ctx)
 	if err != nil {
 		app.log.Error("Error while shutdown server", slog.String("error", err.Error()))
@@ -69,5 +134,16 @@ func(app *App) stopApp(ctx context.Context) error {
 	} else {
 		app.log.Info("Service is Down")
 	}
+
+	if closer, ok := app.storage.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil {
+			app.log.Error("Error while closing storage", slog.String("error", closeErr.Error()))
+			if err == nil {
+				err = closeErr
+			}
+		} else {
+			app.log.Info("Storage is closed")
+		}
+	}
 	return err
 }
\ No newline at end of file
@@ -0,0 +1,159 @@
+// Package auth authenticates API clients by static API keys or JWT bearer
+// tokens and describes what they may do with scopes.
+//
+// API keys are sent as "X-API-Key: <key>" or "Authorization: Bearer <key>"
+// and are configured by the hex SHA-256 of the key only. Bearer tokens that
+// look like a JWT are verified with the configured public key.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+const (
+	// ScopeVerify allows checking links, polling jobs and reading link history.
+	ScopeVerify = "links:verify"
+	// ScopePackagesRead allows reading the packages created by the same client.
+	ScopePackagesRead = "packages:read"
+	// ScopePackagesReadAll allows reading every package.
+	ScopePackagesReadAll = "packages:read:all"
+	// ScopeAdmin allows everything, including webhooks and deleting packages.
+	ScopeAdmin = "admin"
+)
+
+const HeaderAPIKey = "X-API-Key"
+
+// Sources of the principals.
+const (
+	SourceAPIKey = "key"
+	SourceJWT = "jwt"
+)
+
+var (
+	ErrUnauthorized = errors.New("Unauthorized")
+	ErrForbidden = errors.New("Forbidden")
+)
+
+// Principal is an authenticated client.
+type Principal struct {
+	Name string
+	// Source is how the client authenticated, SourceAPIKey or SourceJWT.
+	Source string
+	Scopes []string
+}
+
+// Allowed reports whether the principal has the scope or one implying it.
+func(p Principal) Allowed(scope string) bool {
+	if slices.Contains(p.Scopes, ScopeAdmin) || slices.Contains(p.Scopes, scope) {
+		return true
+	}
+	return scope == ScopePackagesRead && slices.Contains(p.Scopes, ScopePackagesReadAll)
+}
+
+// ID identifies the principal among all sources: an API key and a JWT
+// subject with the same name are different clients.
+func(p Principal) ID() string {
+	return p.Source + ":" + p.Name
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal of the request. There is none when
+// authentication is disabled.
+func FromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+type Authenticator struct {
+	log *slog.Logger
+	// keys maps the hex SHA-256 of every API key to its client.
+	keys map[string]Principal
+	jwt *jwtVerifier
+}
+
+func NewAuthenticator(cfg config.AuthConfig, log *slog.Logger) (*Authenticator, error) {
+	keys := cfg.Keys
+	if cfg.KeysFile != "" {
+		var file struct {
+			Keys []config.APIKey `yaml:"keys"`
+		}
+		if err := cleanenv.ReadConfig(cfg.KeysFile, &file); err != nil {
+			return nil, fmt.Errorf("KeysFileReadingError: %w", err)
+		}
+		keys = append(slices.Clone(keys), file.Keys...)
+	}
+
+	authenticator := &Authenticator{
+		log: log,
+		keys: make(map[string]Principal, len(keys)),
+	}
+	for _, key := range keys {
+		hash := strings.ToLower(key.Hash)
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("InvalidKeyHash: %s", key.Name)
+		}
+		authenticator.keys[hash] = Principal{Name: key.Name, Source: SourceAPIKey, Scopes: key.Scopes}
+	}
+
+	if cfg.JWT.PublicKeyFile != "" {
+		verifier, err := newJWTVerifier(cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.jwt = verifier
+	}
+
+	log.Info(
+		"Authentication enabled",
+		slog.Int("keys", len(authenticator.keys)),
+		slog.Bool("jwt", authenticator.jwt != nil),
+	)
+	return authenticator, nil
+}
+
+// Authenticate returns the client of the credentials of the request.
+func(a *Authenticator) Authenticate(request *http.Request) (Principal, error) {
+	credential := request.Header.Get(HeaderAPIKey)
+	if credential == "" {
+		scheme, token, ok := strings.Cut(request.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return Principal{}, fmt.Errorf("%w: no credentials", ErrUnauthorized)
+		}
+		credential = strings.TrimSpace(token)
+		if a.jwt != nil && strings.Count(credential, ".") == 2 {
+			principal, err := a.jwt.verify(credential)
+			if err != nil {
+				return Principal{}, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+			}
+			return principal, nil
+		}
+	}
+
+	principal, ok := a.keys[HashKey(credential)]
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrUnauthorized)
+	}
+	return principal, nil
+}
+
+// HashKey returns the hex SHA-256 of the key as it is written in the config.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/config"
+)
+
+func writePublicKey(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func signToken(t *testing.T, alg string, claims map[string]any, sign func(signed []byte) []byte) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestAuthenticator_APIKeys(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "keys.yaml")
+	content := "keys:\n  - name: reader\n    hash: " + HashKey("reader-key") + "\n    scopes: [\"packages:read\"]\n"
+	if err := os.WriteFile(keysFile, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	authenticator, err := NewAuthenticator(config.AuthConfig{
+		Keys: []config.APIKey{{Name: "ci", Hash: HashKey("ci-key"), Scopes: []string{ScopeVerify}}},
+		KeysFile: keysFile,
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+
+	request := httptest.NewRequest("POST", "/links", nil)
+	request.Header.Set(HeaderAPIKey, "ci-key")
+	principal, err := authenticator.Authenticate(request)
+	if err != nil || principal.ID() != "key:ci" || !principal.Allowed(ScopeVerify) || principal.Allowed(ScopeAdmin) {
+		t.Errorf("Unexpected principal %+v, error %v", principal, err)
+	}
+
+	request = httptest.NewRequest("GET", "/packages", nil)
+	request.Header.Set("Authorization", "Bearer reader-key")
+	if principal, err = authenticator.Authenticate(request); err != nil || principal.Name != "reader" {
+		t.Errorf("Expected the key of the keys file, got %+v, error %v", principal, err)
+	}
+
+	request.Header.Set("Authorization", "Bearer wrong-key")
+	if _, err = authenticator.Authenticate(request); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected %v for an unknown key, got %v", ErrUnauthorized, err)
+	}
+	if _, err = authenticator.Authenticate(httptest.NewRequest("GET", "/packages", nil)); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected %v without credentials, got %v", ErrUnauthorized, err)
+	}
+
+	_, err = NewAuthenticator(config.AuthConfig{Keys: []config.APIKey{{Name: "plain", Hash: "ci-key"}}}, slog.Default())
+	if err == nil {
+		t.Error("Expected an error for a key that is not a SHA-256 hash")
+	}
+}
+
+func TestPrincipal_Allowed(t *testing.T) {
+	admin := Principal{Scopes: []string{ScopeAdmin}}
+	readAll := Principal{Scopes: []string{ScopePackagesReadAll}}
+	if !admin.Allowed(ScopeVerify) || !admin.Allowed(ScopePackagesReadAll) {
+		t.Error("Expected admin to allow every scope")
+	}
+	if !readAll.Allowed(ScopePackagesRead) || readAll.Allowed(ScopeVerify) {
+		t.Error("Expected packages:read:all to imply packages:read only")
+	}
+}
+
+func TestAuthenticator_JWT(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	ecPrivate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaPrivate, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	tests := []struct {
+		alg string
+		public crypto.PublicKey
+		sign func(signed []byte) []byte
+	}{
+		{"EdDSA", edPublic, func(signed []byte) []byte {
+			return ed25519.Sign(edPrivate, signed)
+		}},
+		{"ES256", &ecPrivate.PublicKey, func(signed []byte) []byte {
+			digest := sha256.Sum256(signed)
+			r, s, _ := ecdsa.Sign(rand.Reader, ecPrivate, digest[:])
+			return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}},
+		{"RS256", &rsaPrivate.PublicKey, func(signed []byte) []byte {
+			digest := sha256.Sum256(signed)
+			signature, _ := rsa.SignPKCS1v15(rand.Reader, rsaPrivate, crypto.SHA256, digest[:])
+			return signature
+		}},
+	}
+	for _, tt := range tests {
+		authenticator, err := NewAuthenticator(config.AuthConfig{
+			JWT: config.JWTConfig{PublicKeyFile: writePublicKey(t, tt.public), Issuer: "idp", Audience: "links"},
+		}, slog.Default())
+		if err != nil {
+			t.Fatalf("%s: NewAuthenticator failed: %v", tt.alg, err)
+		}
+		claims := map[string]any{
+			"sub": "team-a",
+			"iss": "idp",
+			"aud": []string{"links", "other"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"scope": "links:verify packages:read",
+		}
+
+		request := httptest.NewRequest("POST", "/links", nil)
+		request.Header.Set("Authorization", "Bearer " + signToken(t, tt.alg, claims, tt.sign))
+		principal, err := authenticator.Authenticate(request)
+		if err != nil {
+			t.Fatalf("%s: Authenticate failed: %v", tt.alg, err)
+		}
+		if principal.ID() != "jwt:team-a" || !slices.Equal(principal.Scopes, []string{ScopeVerify, ScopePackagesRead}) {
+			t.Errorf("%s: unexpected principal %+v", tt.alg, principal)
+		}
+
+		rejected := map[string]string{
+			"expired": signToken(t, tt.alg, map[string]any{"sub": "team-a", "iss": "idp", "aud": "links", "exp": time.Now().Add(-time.Hour).Unix()}, tt.sign),
+			"wrong audience": signToken(t, tt.alg, map[string]any{"sub": "team-a", "iss": "idp", "aud": "billing", "exp": time.Now().Add(time.Hour).Unix()}, tt.sign),
+			"alg none": signToken(t, "none", claims, func([]byte) []byte { return nil }),
+		}
+		// The claims of another subject with the signature of the valid token.
+		valid := signToken(t, tt.alg, claims, tt.sign)
+		forged := signToken(t, tt.alg, map[string]any{"sub": "admin", "iss": "idp", "aud": "links", "exp": time.Now().Add(time.Hour).Unix()}, tt.sign)
+		rejected["tampered"] = forged[:strings.LastIndex(forged, ".")] + valid[strings.LastIndex(valid, "."):]
+		for name, token := range rejected {
+			request.Header.Set("Authorization", "Bearer " + token)
+			if _, err := authenticator.Authenticate(request); !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("%s: expected %s token to be rejected, got %v", tt.alg, name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/config"
+)
+
+// jwtLeeway tolerates clock skew between the issuer and the service.
+const jwtLeeway = 30 * time.Second
+
+var errInvalidToken = errors.New("InvalidToken")
+
+// jwtVerifier checks compact JWS tokens signed with RS256, ES256 or EdDSA,
+// whichever matches the type of the public key.
+type jwtVerifier struct {
+	key crypto.PublicKey
+	alg string
+	issuer string
+	audience string
+	now func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Subject string `json:"sub"`
+	Issuer string `json:"iss"`
+	Audience audience `json:"aud"`
+	ExpiresAt *int64 `json:"exp"`
+	NotBefore *int64 `json:"nbf"`
+	// Scope is the space separated list of RFC 8693, Scopes a JSON list.
+	Scope string `json:"scope"`
+	Scopes []string `json:"scopes"`
+}
+
+// audience is the "aud" claim, a string or a list of strings.
+type audience []string
+
+func(a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func newJWTVerifier(cfg config.JWTConfig) (*jwtVerifier, error) {
+	data, err := os.ReadFile(cfg.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("PublicKeyReadingError: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("PublicKeyIsNotPEM")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("PublicKeyParsingError: %w", err)
+	}
+
+	verifier := &jwtVerifier{
+		key: key,
+		issuer: cfg.Issuer,
+		audience: cfg.Audience,
+		now: time.Now,
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		verifier.alg = "RS256"
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("UnsupportedPublicKey: only P-256 ECDSA keys are supported")
+		}
+		verifier.alg = "ES256"
+	case ed25519.PublicKey:
+		verifier.alg = "EdDSA"
+	default:
+		return nil, fmt.Errorf("UnsupportedPublicKey: %T", key)
+	}
+	return verifier, nil
+}
+
+func(v *jwtVerifier) verify(token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, errInvalidToken
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, err
+	}
+	// The algorithm is fixed by the key, so "none" or HS256 signed with the
+	// public key are rejected here.
+	if header.Alg != v.alg {
+		return Principal{}, fmt.Errorf("%w: unexpected alg %s", errInvalidToken, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+	if !v.verifySignature([]byte(parts[0] + "." + parts[1]), signature) {
+		return Principal{}, fmt.Errorf("%w: bad signature", errInvalidToken)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, err
+	}
+	if err := v.validate(claims); err != nil {
+		return Principal{}, err
+	}
+
+	scopes := slices.Clone(claims.Scopes)
+	scopes = append(scopes, strings.Fields(claims.Scope)...)
+	return Principal{Name: claims.Subject, Source: SourceJWT, Scopes: scopes}, nil
+}
+
+func(v *jwtVerifier) verifySignature(signed, signature []byte) bool {
+	switch key := v.key.(type) {
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		// JWS carries the raw r || s pair instead of ASN.1.
+		if len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(signed)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, digest[:], r, s)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, signed, signature)
+	}
+	return false
+}
+
+func(v *jwtVerifier) validate(claims jwtClaims) error {
+	now := v.now()
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: no exp", errInvalidToken)
+	}
+	if now.After(time.Unix(*claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return fmt.Errorf("%w: expired", errInvalidToken)
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return fmt.Errorf("%w: not valid yet", errInvalidToken)
+	}
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: no sub", errInvalidToken)
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return fmt.Errorf("%w: unexpected iss", errInvalidToken)
+	}
+	if v.audience != "" && !slices.Contains(claims.Audience, v.audience) {
+		return fmt.Errorf("%w: unexpected aud", errInvalidToken)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+	return nil
+}
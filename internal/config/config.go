@@ -3,19 +3,37 @@ package config
 import (
 	"flag"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+const (
+	StorageMemory = "memory"
+	StorageDisk = "disk"
+
+	PackageIDsSequential = "sequential"
+	PackageIDsUUIDv7 = "uuidv7"
+)
+
 type Config struct {
 	Server ServerConfig `yaml:"server"`
 	Log LogConfig `yaml:"log"`
 	Storage StorageConfig `yaml:"storage"`
+	Probe ProbeConfig `yaml:"probe"`
+	Revalidation RevalidationConfig `yaml:"revalidation"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	Jobs JobsConfig `yaml:"jobs"`
+	Auth AuthConfig `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
 }
 
 type ServerConfig struct {
 	Host string `yaml:"host"`
 	Port int `yaml:"port"`	
+	// DrainDelay is how long /readyz fails before the server shuts down,
+	// for load balancers to stop sending requests.
+	DrainDelay time.Duration `yaml:"drain_delay"`
 }
 
 type LogConfig struct {
@@ -24,8 +42,173 @@ type LogConfig struct {
 }
 
 type StorageConfig struct {
+	// LinksSize is the maximum number of stored packages; the oldest ones that
+	// are not pinned are evicted beyond it. Zero keeps every package.
 	LinksSize int `yaml:"links_size"`
+	// PackageMaxAge is how long a package that is not pinned is kept. Zero
+	// keeps packages until they are evicted by LinksSize.
+	PackageMaxAge time.Duration `yaml:"package_max_age"`
+	// PackageIDs selects the IDs of new packages: "sequential" numbers
+	// (default) or random "uuidv7" that cannot be guessed. Numeric IDs of
+	// existing packages stay readable unless RejectNumericIDs is set.
+	PackageIDs string `yaml:"package_ids"`
+	RejectNumericIDs bool `yaml:"reject_numeric_ids"`
 	CacheSize int `yaml:"cache_size"`
+	// CacheTTL is how long a cached status is served without a new check.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// HistoryRetention is how long check results are kept in the link history.
+	HistoryRetention time.Duration `yaml:"history_retention"`
+	// HistoryRawRetention is how long every check is kept as is; older ones
+	// are merged into buckets of HistoryResolution.
+	HistoryRawRetention time.Duration `yaml:"history_raw_retention"`
+	HistoryResolution time.Duration `yaml:"history_resolution"`
+	// Type selects the storage backend: "memory" (default) or "disk".
+	Type string `yaml:"type"`
+	// Path is the directory where the disk backend keeps its snapshot and write-ahead log.
+	Path string `yaml:"path"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	// SyncWrites forces fsync after every write-ahead log record.
+	SyncWrites bool `yaml:"sync_writes"`
+}
+
+type ProbeConfig struct {
+	// Workers caps the number of links probed at the same time.
+	Workers int `yaml:"workers"`
+	// PerHost caps the number of simultaneous probes of a single host.
+	PerHost int `yaml:"per_host"`
+	// QueueSize is the capacity of each of the API and background queues.
+	QueueSize int `yaml:"queue_size"`
+	Timeout time.Duration `yaml:"timeout"`
+	// HTTPSOnly disables the plain HTTP fallback for links given without a scheme.
+	HTTPSOnly bool `yaml:"https_only"`
+	// MaxLinks caps the number of links of one verification request.
+	MaxLinks int `yaml:"max_links"`
+	// AcceptedStatuses are the status codes of an available link, single ones
+	// like "200" or ranges like "200-299". Default: "200-299".
+	AcceptedStatuses []string `yaml:"accepted_statuses"`
+	// Method is "GET" (default) or "HEAD". HEAD falls back to GET if the
+	// server rejects it with 405 or 501; links with body assertions are
+	// always checked with GET.
+	Method string `yaml:"method"`
+	// MaxRedirects caps the redirects followed by a check, 10 by default.
+	MaxRedirects int `yaml:"max_redirects"`
+	// NoRedirects doesn't follow redirects: the redirect response is the result.
+	NoRedirects bool `yaml:"no_redirects"`
+	Checks []CheckRule `yaml:"checks"`
+}
+
+// CheckRule adds assertions to the check of links whose canonical key matches
+// Pattern, a regular expression. The first matching rule wins. A link that
+// answers but fails an assertion is not available.
+type CheckRule struct {
+	Pattern string `yaml:"pattern"`
+	// AcceptedStatuses replace the ones of ProbeConfig for the matching links.
+	AcceptedStatuses []string `yaml:"accepted_statuses"`
+	BodyContains []string `yaml:"body_contains"`
+	BodyNotContains []string `yaml:"body_not_contains"`
+	// BodyMatches is a regular expression the body must match.
+	BodyMatches string `yaml:"body_matches"`
+	JSON []JSONAssertion `yaml:"json"`
+	// Headers must be present in the response; those with a value must have it.
+	Headers map[string]string `yaml:"headers"`
+	// MaxBodySize, in bytes, also caps how much of the body is read. Without
+	// it body assertions see the first MiB.
+	MaxBodySize int64 `yaml:"max_body_size"`
+	// MaxLatency caps the time until the response headers are received.
+	MaxLatency time.Duration `yaml:"max_latency"`
+}
+
+// JSONAssertion requires the value at Path, like "$.status" or
+// "$.items[0].id", to equal Equals.
+type JSONAssertion struct {
+	Path string `yaml:"path"`
+	Equals any `yaml:"equals"`
+}
+
+type RevalidationConfig struct {
+	// Interval between checks of a cached link unless a rule overrides it.
+	Interval time.Duration `yaml:"interval"`
+	// Jitter shifts the check time of every link by up to ±Jitter.
+	Jitter time.Duration `yaml:"jitter"`
+	// Tick is how often due links are collected and checked.
+	Tick time.Duration `yaml:"tick"`
+	Rules []RevalidationRule `yaml:"rules"`
+}
+
+// RevalidationRule sets the interval of links whose canonical key matches
+// Pattern, a regular expression. The first matching rule wins.
+type RevalidationRule struct {
+	Pattern string `yaml:"pattern"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+type WebhooksConfig struct {
+	// Endpoints registered at startup, more can be added through the API.
+	Endpoints []WebhookEndpoint `yaml:"endpoints"`
+	// MaxAttempts is the number of delivery attempts of one event.
+	MaxAttempts int `yaml:"max_attempts"`
+	// RetryBackoff is the delay before the second attempt, doubled after each failure.
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	Timeout time.Duration `yaml:"timeout"`
+	Workers int `yaml:"workers"`
+	QueueSize int `yaml:"queue_size"`
+	// LogSize is the number of deliveries kept in the delivery log.
+	LogSize int `yaml:"log_size"`
+}
+
+type JobsConfig struct {
+	// Retention is how long a finished job can be polled before it is removed.
+	Retention time.Duration `yaml:"retention"`
+	// MaxJobs caps the number of kept jobs, running and finished.
+	MaxJobs int `yaml:"max_jobs"`
+}
+
+type AuthConfig struct {
+	// Enabled requires credentials on every API endpoint.
+	Enabled bool `yaml:"enabled"`
+	Keys []APIKey `yaml:"keys"`
+	// KeysFile is a YAML file with more keys in a "keys" list.
+	KeysFile string `yaml:"keys_file"`
+	JWT JWTConfig `yaml:"jwt"`
+}
+
+type APIKey struct {
+	// Name identifies the client in logs and owns the packages it creates.
+	Name string `yaml:"name"`
+	// Hash is the hex SHA-256 of the key, the key itself is never stored.
+	Hash string `yaml:"hash"`
+	Scopes []string `yaml:"scopes"`
+}
+
+type JWTConfig struct {
+	// PublicKeyFile is a PEM file with the RSA, ECDSA P-256 or Ed25519 key
+	// that signs bearer tokens. Tokens are not accepted without it.
+	PublicKeyFile string `yaml:"public_key_file"`
+	// Issuer and Audience, if set, must match the "iss" and "aud" claims.
+	Issuer string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+}
+
+// RateLimitConfig limits every client, identified by its API key or, without
+// authentication, by its IP address. Zero values disable a limit.
+type RateLimitConfig struct {
+	// Rate is the number of requests per second a client may make on average.
+	Rate float64 `yaml:"rate"`
+	// Burst is the number of requests a client may make at once.
+	Burst int `yaml:"burst"`
+	// MaxLinksPerRequest caps the links of one verification request of a client.
+	MaxLinksPerRequest int `yaml:"max_links_per_request"`
+	// MaxLinksPerDay caps the links a client may submit for verification per UTC day.
+	MaxLinksPerDay int `yaml:"max_links_per_day"`
+	// TrustForwardedFor takes the client IP from the last X-Forwarded-For
+	// entry. Enable it only behind a reverse proxy that sets the header.
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"`
+}
+
+type WebhookEndpoint struct {
+	URL string `yaml:"url"`
+	Secret string `yaml:"secret"`
+	Events []string `yaml:"events"`
 }
 
 func MustLoad() Config {
@@ -60,4 +243,4 @@ func loadConfig(path string) Config {
 	}
 	
 	return cfg
-}
\ No newline at end of file
+}
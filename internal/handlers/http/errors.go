@@ -0,0 +1,77 @@
+package http
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/auth"
+	"github.com/behummble/29-11-2025/internal/models"
+	"github.com/behummble/29-11-2025/internal/webhook"
+)
+
+// errorStatuses maps the service errors to status codes, the first match wins.
+// Other errors are answered with 500.
+var errorStatuses = []struct {
+	err error
+	code int
+}{
+	{models.ErrDecodingData, http.StatusBadRequest},
+	{models.ErrEmptyBody, http.StatusBadRequest},
+	{models.ErrEmptyLink, http.StatusBadRequest},
+	{models.ErrInvalidTimeWindow, http.StatusBadRequest},
+	{models.ErrInvalidPagination, http.StatusBadRequest},
+	{models.ErrInvalidPackageID, http.StatusBadRequest},
+	{webhook.ErrInvalidWebhook, http.StatusBadRequest},
+	{auth.ErrUnauthorized, http.StatusUnauthorized},
+	{auth.ErrForbidden, http.StatusForbidden},
+	{models.ErrPackageNotFound, http.StatusNotFound},
+	{models.ErrJobNotFound, http.StatusNotFound},
+	{webhook.ErrWebhookNotFound, http.StatusNotFound},
+	{models.ErrPackageExpired, http.StatusGone},
+	{models.ErrUnsupportedFormat, http.StatusNotAcceptable},
+	{models.ErrTooManyLinks, http.StatusRequestEntityTooLarge},
+	{errRateLimited, http.StatusTooManyRequests},
+	{errQuotaExceeded, http.StatusTooManyRequests},
+	{models.ErrShuttingDown, http.StatusServiceUnavailable},
+	{models.ErrTooManyJobs, http.StatusServiceUnavailable},
+	{models.ErrPackageStoreFull, http.StatusInsufficientStorage},
+}
+
+func errorStatus(err error) int {
+	for _, status := range errorStatuses {
+		if errors.Is(err, status.err) {
+			return status.code
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError answers with the status code of the service error.
+func(s *Server) writeError(writer http.ResponseWriter, err error) {
+	s.writeErrorCode(writer, errorStatus(err), err)
+}
+
+// writeErrorCode writes the error as the documented Error body.
+func(s *Server) writeErrorCode(writer http.ResponseWriter, code int, err error) {
+	if code >= http.StatusInternalServerError {
+		s.log.Error(
+			"HandlingRequestError",
+			slog.String("component", "http"),
+			slog.Int("code", code),
+			slog.Any("error", err),
+		)
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+	writer.Write(prepareResponse(errorResponse(code, err), s.log))
+}
+
+func errorResponse(code int, err error) models.ErrorResponse {
+	return models.ErrorResponse{
+		Error: err.Error(),
+		Code: code,
+		Timestamp: time.Now().UTC(),
+	}
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+var errNotListening = errors.New("ServerIsNotListening")
+
+// ReadinessCheck reports why a dependency of the server cannot serve yet.
+type ReadinessCheck func() error
+
+type readinessCheck struct {
+	name string
+	check ReadinessCheck
+}
+
+// AddReadinessCheck makes /readyz fail while the check does. Checks are added
+// before Start.
+func(s *Server) AddReadinessCheck(name string, check ReadinessCheck) {
+	s.checks = append(s.checks, readinessCheck{name: name, check: check})
+}
+
+// Drain makes /readyz fail so that load balancers stop sending requests,
+// while the server keeps answering the ones that still arrive.
+func(s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+// Healthz reports that the process is alive.
+func(s *Server) Healthz(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(prepareResponse(models.HealthResponse{Status: models.HealthOK}, s.log))
+}
+
+// Readyz reports whether the server can take traffic, with the result of every check.
+func(s *Server) Readyz(writer http.ResponseWriter, request *http.Request) {
+	res := models.HealthResponse{Status: models.HealthOK, Checks: make(map[string]string, len(s.checks) + 1)}
+	checks := append([]readinessCheck{{name: "server", check: s.serving}}, s.checks...)
+	for _, check := range checks {
+		if err := check.check(); err != nil {
+			res.Status = models.HealthUnavailable
+			res.Checks[check.name] = err.Error()
+		} else {
+			res.Checks[check.name] = models.HealthOK
+		}
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	if res.Status != models.HealthOK {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writer.Write(prepareResponse(res, s.log))
+}
+
+func(s *Server) serving() error {
+	switch {
+	case s.draining.Load():
+		return models.ErrShuttingDown
+	case !s.listening.Load():
+		return errNotListening
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		"http_requests_total",
+		"HTTP requests by route, method and status code.",
+		"route", "method", "code",
+	)
+	requestDuration = metrics.NewHistogramVec(
+		"http_request_duration_seconds",
+		"Latency of HTTP requests by route and method.",
+		nil,
+		"route", "method",
+	)
+)
+
+// instrument counts the requests and their latency by the route pattern they
+// matched, so that path values do not add series.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: writer, code: http.StatusOK}
+		next.ServeHTTP(recorder, request)
+
+		// The mux sets the pattern on the request it was given.
+		route := request.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		requestsTotal.Inc(route, request.Method, strconv.Itoa(recorder.code))
+		requestDuration.Observe(time.Since(start).Seconds(), route, request.Method)
+	})
+}
+
+// statusRecorder keeps the status code written by the handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+	wroteHeader bool
+}
+
+func(r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.code = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController flush the streamed responses.
+func(r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
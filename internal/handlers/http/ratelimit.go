@@ -0,0 +1,279 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/auth"
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+// clientsSweepInterval is how often clients with nothing left to limit are forgotten.
+const clientsSweepInterval = time.Minute
+
+var (
+	errRateLimited = errors.New("RateLimited")
+	errQuotaExceeded = errors.New("QuotaExceeded")
+)
+
+// rateLimiter keeps a token bucket and the daily link count of every client.
+type rateLimiter struct {
+	mutex sync.Mutex
+	clients map[string]*clientLimits
+	rate float64
+	burst float64
+	maxLinksPerRequest int
+	maxLinksPerDay int
+	trustForwardedFor bool
+	lastSweep time.Time
+	now func() time.Time
+}
+
+type clientLimits struct {
+	tokens float64
+	updated time.Time
+	// day is the start of the UTC day the links were counted in.
+	day time.Time
+	links int
+}
+
+// newRateLimiter returns nil if no limit is configured.
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	if cfg.Rate <= 0 && cfg.MaxLinksPerRequest <= 0 && cfg.MaxLinksPerDay <= 0 {
+		return nil
+	}
+	burst := float64(cfg.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(cfg.Rate))
+	}
+	return &rateLimiter{
+		clients: make(map[string]*clientLimits),
+		rate: cfg.Rate,
+		burst: burst,
+		maxLinksPerRequest: cfg.MaxLinksPerRequest,
+		maxLinksPerDay: cfg.MaxLinksPerDay,
+		trustForwardedFor: cfg.TrustForwardedFor,
+		now: time.Now,
+	}
+}
+
+// allow takes a token of the client. If there is none it returns how long
+// the client has to wait for the next one.
+func(l *rateLimiter) allow(client string) (bool, time.Duration) {
+	if l.rate <= 0 {
+		return true, 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	limits := l.refill(client)
+	if limits.tokens < 1 {
+		return false, l.wait(limits)
+	}
+	limits.tokens--
+	return true, 0
+}
+
+// throttled reports whether the client is out of tokens, without taking one,
+// and how long it has to wait for the next one.
+func(l *rateLimiter) throttled(client string) (bool, time.Duration) {
+	if l.rate <= 0 {
+		return false, 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	limits := l.refill(client)
+	if limits.tokens < 1 {
+		return true, l.wait(limits)
+	}
+	return false, 0
+}
+
+// refill adds the tokens earned since the last update to the bucket of the
+// client. The caller must hold l.mutex.
+func(l *rateLimiter) refill(client string) *clientLimits {
+	now := l.now()
+	limits := l.client(client, now)
+	limits.tokens = math.Min(l.burst, limits.tokens + now.Sub(limits.updated).Seconds() * l.rate)
+	limits.updated = now
+	return limits
+}
+
+// wait is how long until the bucket holds a token again.
+func(l *rateLimiter) wait(limits *clientLimits) time.Duration {
+	return time.Duration((1 - limits.tokens) / l.rate * float64(time.Second))
+}
+
+// takeLinks counts n links against the quotas of the client. If the daily
+// quota is exceeded it returns how long until it is reset.
+func(l *rateLimiter) takeLinks(client string, n int) (time.Duration, error) {
+	if l.maxLinksPerRequest > 0 && n > l.maxLinksPerRequest {
+		return 0, fmt.Errorf("%w: %d > %d per request", models.ErrTooManyLinks, n, l.maxLinksPerRequest)
+	}
+	if l.maxLinksPerDay <= 0 {
+		return 0, nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	limits := l.client(client, now)
+	day := now.UTC().Truncate(24 * time.Hour)
+	if !limits.day.Equal(day) {
+		limits.day = day
+		limits.links = 0
+	}
+	if limits.links + n > l.maxLinksPerDay {
+		return day.Add(24 * time.Hour).Sub(now), fmt.Errorf("%w: %d of %d links per day used", errQuotaExceeded, limits.links, l.maxLinksPerDay)
+	}
+	limits.links += n
+	return 0, nil
+}
+
+// refundLinks gives back n links taken from the daily quota of the client
+// today, for a request that failed.
+func(l *rateLimiter) refundLinks(client string, n int) {
+	if l.maxLinksPerDay <= 0 || n <= 0 {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	limits := l.client(client, now)
+	if limits.day.Equal(now.UTC().Truncate(24 * time.Hour)) {
+		limits.links = max(0, limits.links - n)
+	}
+}
+
+// client returns the limits of the client, creating them with a full bucket.
+// The caller must hold l.mutex.
+func(l *rateLimiter) client(client string, now time.Time) *clientLimits {
+	if now.Sub(l.lastSweep) > clientsSweepInterval {
+		l.sweep(now)
+	}
+	limits, ok := l.clients[client]
+	if !ok {
+		limits = &clientLimits{tokens: l.burst, updated: now}
+		l.clients[client] = limits
+	}
+	return limits
+}
+
+// sweep forgets the clients whose bucket is full again and whose links were
+// counted on an earlier day. The caller must hold l.mutex.
+func(l *rateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	day := now.UTC().Truncate(24 * time.Hour)
+	for client, limits := range l.clients {
+		refilled := l.rate <= 0 || limits.tokens + now.Sub(limits.updated).Seconds() * l.rate >= l.burst
+		if refilled && limits.day.Before(day) {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// clientID identifies the client of the request by its API key or JWT
+// subject or, without authentication, by its IP address.
+func(l *rateLimiter) clientID(request *http.Request) string {
+	if principal, ok := auth.FromContext(request.Context()); ok {
+		return "client:" + principal.ID()
+	}
+	if l.trustForwardedFor {
+		if values := request.Header.Values("X-Forwarded-For"); len(values) != 0 {
+			hops := strings.Split(values[len(values) - 1], ",")
+			if ip := strings.TrimSpace(hops[len(hops) - 1]); ip != "" {
+				return "ip:" + ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit answers with 429 once the client runs out of tokens.
+func(s *Server) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if s.limiter == nil {
+			next(writer, request)
+			return
+		}
+		if ok, wait := s.limiter.allow(s.limiter.clientID(request)); !ok {
+			setRetryAfter(writer, wait)
+			s.writeError(writer, errRateLimited)
+			return
+		}
+		next(writer, request)
+	}
+}
+
+// authThrottled answers with 429 if the address of the request used up its
+// tokens on failed authentications, so API keys cannot be guessed at full speed.
+func(s *Server) authThrottled(writer http.ResponseWriter, request *http.Request) bool {
+	if s.limiter == nil {
+		return false
+	}
+	if throttled, wait := s.limiter.throttled(s.limiter.clientID(request)); throttled {
+		setRetryAfter(writer, wait)
+		s.writeError(writer, errRateLimited)
+		return true
+	}
+	return false
+}
+
+// authFailed takes a token of the address of a request that failed to
+// authenticate. The request must not carry a principal yet.
+func(s *Server) authFailed(request *http.Request) {
+	if s.limiter != nil {
+		s.limiter.allow(s.limiter.clientID(request))
+	}
+}
+
+// takeLinks applies the link quotas to the links of a verification request
+// and returns how many links it took. Bodies that do not decode are left for
+// the service to reject.
+func(s *Server) takeLinks(writer http.ResponseWriter, request *http.Request, data []byte) (int, bool) {
+	if s.limiter == nil {
+		return 0, true
+	}
+	var linksRequest models.VerifyLinksRequest
+	if err := json.Unmarshal(data, &linksRequest); err != nil {
+		return 0, true
+	}
+	wait, err := s.limiter.takeLinks(s.limiter.clientID(request), len(linksRequest.Links))
+	if err != nil {
+		if wait > 0 {
+			setRetryAfter(writer, wait)
+		}
+		s.writeError(writer, err)
+		return 0, false
+	}
+	return len(linksRequest.Links), true
+}
+
+// refundLinks gives back the links takeLinks took for a request the service
+// rejected, so invalid links, a full job queue or a shutdown do not use up
+// the daily quota.
+func(s *Server) refundLinks(request *http.Request, n int) {
+	if s.limiter != nil {
+		s.limiter.refundLinks(s.limiter.clientID(request), n)
+	}
+}
+
+func setRetryAfter(writer http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	writer.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+}
@@ -7,10 +7,16 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/behummble/29-11-2025/internal/auth"
 	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/metrics"
 	"github.com/behummble/29-11-2025/internal/models"
 )
 
@@ -18,33 +24,79 @@ type Server struct {
 	log *slog.Logger
 	server *http.Server
 	service Service
+	auth Authenticator
+	limiter *rateLimiter
+	checks []readinessCheck
+	listening atomic.Bool
+	draining atomic.Bool
 }
 
 type Service interface {
 	VerifyLinks(ctx context.Context, data []byte) (models.VerifyLinksResponse, error)
-	PackageLinks(ctx context.Context, data []byte) ([]byte, error)
+	StreamVerifyLinks(ctx context.Context, data []byte, send func(link string, result models.LinkResult)) (models.VerifyLinksResponse, error)
+	PackageLinks(ctx context.Context, data []byte, accept string) ([]byte, string, error)
+	RegisterWebhook(ctx context.Context, data []byte) (models.Webhook, error)
+	Webhooks(ctx context.Context) []models.Webhook
+	DeleteWebhook(ctx context.Context, id string) error
+	WebhookDeliveries(ctx context.Context, limit int) []models.WebhookDelivery
+	LinkHistory(ctx context.Context, link string, from, to time.Time) ([]models.HistoryPoint, error)
+	LinkUptime(ctx context.Context, link string, from, to time.Time) (models.UptimeReport, error)
+	Package(ctx context.Context, id models.PackageID) (models.PackageResponse, error)
+	Packages(ctx context.Context, filter models.PackageFilter) (models.PackagesPage, error)
+	DeletePackage(ctx context.Context, id models.PackageID) error
+	PinPackage(ctx context.Context, id models.PackageID, pinned bool) error
+	SubmitVerifyJob(ctx context.Context, data []byte) (models.Job, error)
+	Job(ctx context.Context, id string) (models.Job, error)
 }
 
-func NewServer(log *slog.Logger, cfg config.ServerConfig, service Service) *Server {
+// Authenticator identifies the client of a request. Without one every
+// request is allowed.
+type Authenticator interface {
+	Authenticate(request *http.Request) (auth.Principal, error)
+}
+
+const defaultHistoryWindow = 7 * 24 * time.Hour
+
+// requestTimeout bounds the work done for a request, streamed or not.
+const requestTimeout = 30 * time.Second
+
+func NewServer(log *slog.Logger, cfg config.ServerConfig, limits config.RateLimitConfig, service Service, authenticator Authenticator) *Server {
 	server := &Server{
 		log: log,
 		service: service,
+		auth: authenticator,
+		limiter: newRateLimiter(limits),
 	}
 	srv := &http.Server{
 		Addr: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
 	}
 	mux := newMux(server)
-	srv.Handler = mux
+	srv.Handler = instrument(mux)
 	server.server = srv
 	
 	return server
 }
 
-func(s *Server) Start() {
-	err := s.server.ListenAndServe()
-	if err != nil && err != http.ErrServerClosed {
-        panic(err)
-    }
+// Start listens on the configured address and serves in the background.
+// Errors of binding the address are returned.
+func(s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	s.listening.Store(true)
+	go func() {
+		defer s.listening.Store(false)
+		err := s.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			s.log.Error(
+				"ServingError",
+				slog.String("component", "http"),
+				slog.Any("error", err),
+			)
+		}
+	}()
+	return nil
 }
 
 func(s *Server) Shutdown(ctx context.Context) error {
@@ -56,27 +108,34 @@ func(s *Server) GetHandler() http.Handler {
 }
 
 func(s *Server) VerifyLinks(writer http.ResponseWriter, request *http.Request) {
-	ctx, cancel := context.WithTimeout(request.Context(), 30 * time.Second)
+	ctx, cancel := context.WithTimeout(request.Context(), requestTimeout)
 	defer cancel()
 	data, err := executeRequestBody(request, s.log)
 	if err != nil {
-		writer.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(writer, err.Error())
+		s.writeErrorCode(writer, http.StatusBadRequest, err)
 		return
 	}
 
 	s.log.Info("Recive request verify links")
 
 	if len(data) == 0 {
-		writer.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(writer, "Empty body")
+		s.writeError(writer, models.ErrEmptyBody)
+		return
+	}
+	taken, ok := s.takeLinks(writer, request, data)
+	if !ok {
+		return
+	}
+
+	if asyncRequested(request) {
+		s.submitVerifyJob(writer, request, data, taken)
 		return
 	}
 
 	res, err := s.service.VerifyLinks(ctx, data)
 	if err != nil {
-		writer.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(writer, err.Error())
+		s.refundLinks(request, taken)
+		s.writeError(writer, err)
 		return
 	}
 	bytes := prepareResponse(res, s.log)
@@ -84,42 +143,382 @@ func(s *Server) VerifyLinks(writer http.ResponseWriter, request *http.Request) {
 	writer.Write(bytes)
 }
 
+// StreamVerifyLinks sends every result as an event as soon as it is known and
+// ends with a summary event carrying the package ID.
+func(s *Server) StreamVerifyLinks(writer http.ResponseWriter, request *http.Request) {
+	data, err := executeRequestBody(request, s.log)
+	if err != nil {
+		s.writeErrorCode(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	s.log.Info("Recive request to stream verify links")
+
+	if len(data) == 0 {
+		s.writeError(writer, models.ErrEmptyBody)
+		return
+	}
+	taken, ok := s.takeLinks(writer, request, data)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), requestTimeout)
+	defer cancel()
+	stream := newEventStream(writer, request, s.log)
+	res, err := s.service.StreamVerifyLinks(ctx, data, func(link string, result models.LinkResult) {
+		stream.send(models.StreamEventResult, models.StreamResult{Link: link, Result: result})
+	})
+	if err != nil && !stream.started {
+		s.refundLinks(request, taken)
+		s.writeError(writer, err)
+		return
+	}
+	if err != nil {
+		stream.send(models.StreamEventError, errorResponse(errorStatus(err), err))
+		return
+	}
+	stream.send(models.StreamEventSummary, models.StreamSummary{
+		Links_num: res.Links_num,
+		Summary: models.Summarize(res.Results),
+		Canonical: res.Canonical,
+	})
+}
+
+func(s *Server) submitVerifyJob(writer http.ResponseWriter, request *http.Request, data []byte, taken int) {
+	job, err := s.service.SubmitVerifyJob(request.Context(), data)
+	if err != nil {
+		s.refundLinks(request, taken)
+		s.writeError(writer, err)
+		return
+	}
+	bytes := prepareResponse(job, s.log)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Location", "/jobs/" + job.ID)
+	writer.WriteHeader(http.StatusAccepted)
+	writer.Write(bytes)
+}
+
+func(s *Server) Job(writer http.ResponseWriter, request *http.Request) {
+	job, err := s.service.Job(request.Context(), request.PathValue("id"))
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	bytes := prepareResponse(job, s.log)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+}
+
 func(s *Server) LinksReport(writer http.ResponseWriter, request *http.Request) {
-	ctx, cancel := context.WithTimeout(request.Context(), 30 * time.Second)
+	ctx, cancel := context.WithTimeout(request.Context(), requestTimeout)
 	defer cancel()
 	data, err := executeRequestBody(request, s.log)
 	if err != nil {
-		writer.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(writer, err.Error())
+		s.writeErrorCode(writer, http.StatusBadRequest, err)
 		return
 	}
 
 	s.log.Info("Recive request to get link package report")
 
 	if len(data) == 0 {
-		writer.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(writer, "Empty body")
+		s.writeError(writer, models.ErrEmptyBody)
 		return
 	}
-	res, err := s.service.PackageLinks(ctx, data)
+	res, contentType, err := s.service.PackageLinks(ctx, data, request.Header.Get("Accept"))
 	if err != nil {
-		writer.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(writer, err.Error())
+		s.writeError(writer, err)
 		return
 	}
-	writer.Header().Set("Content-Type", "application/pdf")
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Add("Vary", "Accept")
 	writer.WriteHeader(http.StatusOK)	
 	writer.Write(res)
 }
 
+func(s *Server) RegisterWebhook(writer http.ResponseWriter, request *http.Request) {
+	data, err := executeRequestBody(request, s.log)
+	if err != nil {
+		s.writeErrorCode(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	s.log.Info("Recive request to register webhook")
+
+	res, err := s.service.RegisterWebhook(request.Context(), data)
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	bytes := prepareResponse(res, s.log)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusCreated)
+	writer.Write(bytes)
+}
+
+func(s *Server) Webhooks(writer http.ResponseWriter, request *http.Request) {
+	bytes := prepareResponse(s.service.Webhooks(request.Context()), s.log)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+}
+
+func(s *Server) DeleteWebhook(writer http.ResponseWriter, request *http.Request) {
+	err := s.service.DeleteWebhook(request.Context(), request.PathValue("id"))
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func(s *Server) WebhookDeliveries(writer http.ResponseWriter, request *http.Request) {
+	limit := 0
+	if value := request.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			s.writeErrorCode(writer, http.StatusBadRequest, errors.New("InvalidLimit"))
+			return
+		}
+		limit = parsed
+	}
+	bytes := prepareResponse(s.service.WebhookDeliveries(request.Context(), limit), s.log)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+}
+
+func(s *Server) LinkHistory(writer http.ResponseWriter, request *http.Request) {
+	from, to, err := parseWindow(request)
+	if err != nil {
+		s.writeErrorCode(writer, http.StatusBadRequest, err)
+		return
+	}
+	res, err := s.service.LinkHistory(request.Context(), request.URL.Query().Get("link"), from, to)
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	bytes := prepareResponse(res, s.log)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+}
+
+func(s *Server) LinkUptime(writer http.ResponseWriter, request *http.Request) {
+	from, to, err := parseWindow(request)
+	if err != nil {
+		s.writeErrorCode(writer, http.StatusBadRequest, err)
+		return
+	}
+	res, err := s.service.LinkUptime(request.Context(), request.URL.Query().Get("link"), from, to)
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	bytes := prepareResponse(res, s.log)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+}
+
+func(s *Server) Package(writer http.ResponseWriter, request *http.Request) {
+	id, err := models.ParsePackageID(request.PathValue("id"))
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	res, err := s.service.Package(request.Context(), id)
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	bytes := prepareResponse(res, s.log)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+}
+
+func(s *Server) Packages(writer http.ResponseWriter, request *http.Request) {
+	filter, err := parsePackageFilter(request)
+	if err != nil {
+		s.writeErrorCode(writer, http.StatusBadRequest, err)
+		return
+	}
+	res, err := s.service.Packages(request.Context(), filter)
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	bytes := prepareResponse(res, s.log)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+}
+
+func(s *Server) DeletePackage(writer http.ResponseWriter, request *http.Request) {
+	id, err := models.ParsePackageID(request.PathValue("id"))
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	err = s.service.DeletePackage(request.Context(), id)
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// PinPackage keeps the package regardless of the retention policy with PUT
+// and releases it with DELETE.
+func(s *Server) PinPackage(writer http.ResponseWriter, request *http.Request) {
+	id, err := models.ParsePackageID(request.PathValue("id"))
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	err = s.service.PinPackage(request.Context(), id, request.Method == http.MethodPut)
+	if err != nil {
+		s.writeError(writer, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
 func newMux(s *Server) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /links", s.VerifyLinks)
-	mux.HandleFunc("POST /links/list", s.LinksReport)
+	mux.HandleFunc("POST /links", s.api(auth.ScopeVerify, s.VerifyLinks))
+	mux.HandleFunc("POST /links/list", s.api(auth.ScopePackagesRead, s.LinksReport))
+	mux.HandleFunc("POST /links/stream", s.api(auth.ScopeVerify, s.StreamVerifyLinks))
+	mux.HandleFunc("GET /links/history", s.api(auth.ScopeVerify, s.LinkHistory))
+	mux.HandleFunc("GET /links/uptime", s.api(auth.ScopeVerify, s.LinkUptime))
+	mux.HandleFunc("GET /jobs/{id}", s.api(auth.ScopeVerify, s.Job))
+	mux.HandleFunc("GET /packages", s.api(auth.ScopePackagesRead, s.Packages))
+	mux.HandleFunc("GET /packages/{id}", s.api(auth.ScopePackagesRead, s.Package))
+	mux.HandleFunc("DELETE /packages/{id}", s.api(auth.ScopeAdmin, s.DeletePackage))
+	mux.HandleFunc("PUT /packages/{id}/pin", s.api(auth.ScopeAdmin, s.PinPackage))
+	mux.HandleFunc("DELETE /packages/{id}/pin", s.api(auth.ScopeAdmin, s.PinPackage))
+	mux.HandleFunc("GET /webhooks", s.api(auth.ScopeAdmin, s.Webhooks))
+	mux.HandleFunc("POST /webhooks", s.api(auth.ScopeAdmin, s.RegisterWebhook))
+	mux.HandleFunc("DELETE /webhooks/{id}", s.api(auth.ScopeAdmin, s.DeleteWebhook))
+	mux.HandleFunc("GET /webhooks/deliveries", s.api(auth.ScopeAdmin, s.WebhookDeliveries))
+	// Probes and scrapers are not authenticated; restrict /metrics on the network.
+	mux.HandleFunc("GET /healthz", s.Healthz)
+	mux.HandleFunc("GET /readyz", s.Readyz)
+	mux.Handle("GET /metrics", metrics.Handler())
 	
 	return mux
 }
 
+// api wraps the handler of an API endpoint with authorization and rate limiting.
+func(s *Server) api(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return s.authorize(scope, s.rateLimit(next))
+}
+
+// authorize lets the request through to next if its client has the scope,
+// with the client in the request context. Failed authentications take tokens
+// of the IP address, which gets 429 once it runs out of them.
+func(s *Server) authorize(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if s.auth == nil {
+			next(writer, request)
+			return
+		}
+		if s.authThrottled(writer, request) {
+			return
+		}
+		principal, err := s.auth.Authenticate(request)
+		if err != nil {
+			s.authFailed(request)
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="links"`)
+			s.writeError(writer, err)
+			return
+		}
+		if !principal.Allowed(scope) {
+			s.log.Warn(
+				"Forbidden",
+				slog.String("component", "http/auth"),
+				slog.String("client", principal.Name),
+				slog.String("scope", scope),
+				slog.String("path", request.URL.Path),
+			)
+			s.writeError(writer, fmt.Errorf("%w: scope %s required", auth.ErrForbidden, scope))
+			return
+		}
+		next(writer, request.WithContext(auth.WithPrincipal(request.Context(), principal)))
+	}
+}
+
+// asyncRequested reports whether the client asked for an asynchronous job,
+// with "?async=true" or "Prefer: respond-async".
+func asyncRequested(request *http.Request) bool {
+	if async, err := strconv.ParseBool(request.URL.Query().Get("async")); err == nil && async {
+		return true
+	}
+	for _, prefer := range request.Header.Values("Prefer") {
+		for _, preference := range strings.Split(prefer, ",") {
+			if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseWindow reads the RFC 3339 "from" and "to" query parameters. The
+// window defaults to the last week.
+func parseWindow(request *http.Request) (time.Time, time.Time, error) {
+	query := request.URL.Query()
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("InvalidTo")
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultHistoryWindow)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("InvalidFrom")
+		}
+		from = parsed
+	}
+	return from, to, nil
+}
+
+// parsePackageFilter reads the "link", "created_after", "created_before"
+// (RFC 3339), "offset" and "limit" query parameters.
+func parsePackageFilter(request *http.Request) (models.PackageFilter, error) {
+	query := request.URL.Query()
+	filter := models.PackageFilter{Link: query.Get("link")}
+	var err error
+	if value := query.Get("created_after"); value != "" {
+		if filter.CreatedAfter, err = time.Parse(time.RFC3339, value); err != nil {
+			return models.PackageFilter{}, errors.New("InvalidCreatedAfter")
+		}
+	}
+	if value := query.Get("created_before"); value != "" {
+		if filter.CreatedBefore, err = time.Parse(time.RFC3339, value); err != nil {
+			return models.PackageFilter{}, errors.New("InvalidCreatedBefore")
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if filter.Offset, err = strconv.Atoi(value); err != nil {
+			return models.PackageFilter{}, errors.New("InvalidOffset")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil {
+			return models.PackageFilter{}, errors.New("InvalidLimit")
+		}
+	}
+	return filter, nil
+}
+
 func executeRequestBody(request *http.Request, log *slog.Logger) ([]byte, error) {
 	if request.Body == nil {
 		log.Error(
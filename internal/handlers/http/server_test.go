@@ -5,13 +5,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/behummble/29-11-2025/internal/auth"
 	"github.com/behummble/29-11-2025/internal/config"
 	"github.com/behummble/29-11-2025/internal/models"
+	"github.com/behummble/29-11-2025/internal/webhook"
 )
 
 type mockService struct {
@@ -19,28 +25,136 @@ type mockService struct {
 	verifyLinksError    error
 	packageLinksResponse []byte
 	packageLinksError    error
+	webhooks []models.Webhook
+	webhookError error
+	packages map[models.PackageID]models.PackageResponse
+	jobs map[string]models.Job
+	streamDeadline time.Time
 }
 
 func (m *mockService) VerifyLinks(ctx context.Context, data []byte) (models.VerifyLinksResponse, error) {
 	return m.verifyLinksResponse, m.verifyLinksError
 }
 
-func (m *mockService) PackageLinks(ctx context.Context, data []byte) ([]byte, error) {
-	return m.packageLinksResponse, m.packageLinksError
+func (m *mockService) StreamVerifyLinks(ctx context.Context, data []byte, send func(link string, result models.LinkResult)) (models.VerifyLinksResponse, error) {
+	m.streamDeadline, _ = ctx.Deadline()
+	if m.verifyLinksError != nil {
+		return models.VerifyLinksResponse{}, m.verifyLinksError
+	}
+	for link, result := range m.verifyLinksResponse.Results {
+		send(link, result)
+	}
+	return m.verifyLinksResponse, nil
+}
+
+func (m *mockService) PackageLinks(ctx context.Context, data []byte, accept string) ([]byte, string, error) {
+	switch accept {
+	case "", "application/pdf":
+		return m.packageLinksResponse, "application/pdf", m.packageLinksError
+	case "text/csv":
+		return m.packageLinksResponse, "text/csv; charset=utf-8", m.packageLinksError
+	}
+	return nil, "", fmt.Errorf("%w: %s", models.ErrUnsupportedFormat, accept)
+}
+
+func (m *mockService) RegisterWebhook(ctx context.Context, data []byte) (models.Webhook, error) {
+	var hook models.Webhook
+	if err := json.Unmarshal(data, &hook); err != nil {
+		return models.Webhook{}, err
+	}
+	hook.ID = "hook1"
+	m.webhooks = append(m.webhooks, hook)
+	return hook, m.webhookError
+}
+
+func (m *mockService) Webhooks(ctx context.Context) []models.Webhook {
+	return m.webhooks
+}
+
+func (m *mockService) DeleteWebhook(ctx context.Context, id string) error {
+	for i, hook := range m.webhooks {
+		if hook.ID == id {
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", webhook.ErrWebhookNotFound, id)
+}
+
+func (m *mockService) WebhookDeliveries(ctx context.Context, limit int) []models.WebhookDelivery {
+	return nil
+}
+
+func (m *mockService) LinkHistory(ctx context.Context, link string, from, to time.Time) ([]models.HistoryPoint, error) {
+	return []models.HistoryPoint{}, nil
+}
+
+func (m *mockService) LinkUptime(ctx context.Context, link string, from, to time.Time) (models.UptimeReport, error) {
+	return models.UptimeReport{Link: link, From: from, To: to}, nil
+}
+
+func (m *mockService) Package(ctx context.Context, id models.PackageID) (models.PackageResponse, error) {
+	pkg, ok := m.packages[id]
+	if !ok {
+		return models.PackageResponse{}, fmt.Errorf("%w: %s", models.ErrPackageNotFound, id)
+	}
+	return pkg, nil
+}
+
+func (m *mockService) Packages(ctx context.Context, filter models.PackageFilter) (models.PackagesPage, error) {
+	page := models.PackagesPage{Total: len(m.packages), Limit: filter.Limit}
+	for _, pkg := range m.packages {
+		if filter.Link == "" || slices.Contains(pkg.Links, filter.Link) {
+			page.Packages = append(page.Packages, models.PackageSummary{ID: pkg.ID, LinksNum: len(pkg.Links)})
+		}
+	}
+	return page, nil
+}
+
+func (m *mockService) DeletePackage(ctx context.Context, id models.PackageID) error {
+	if _, ok := m.packages[id]; !ok {
+		return fmt.Errorf("%w: %s", models.ErrPackageNotFound, id)
+	}
+	delete(m.packages, id)
+	return nil
+}
+
+func (m *mockService) PinPackage(ctx context.Context, id models.PackageID, pinned bool) error {
+	pkg, ok := m.packages[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", models.ErrPackageNotFound, id)
+	}
+	pkg.Pinned = pinned
+	m.packages[id] = pkg
+	return nil
+}
+
+func (m *mockService) SubmitVerifyJob(ctx context.Context, data []byte) (models.Job, error) {
+	job := models.Job{ID: fmt.Sprintf("job%d", len(m.jobs) + 1), Status: models.JobRunning, Total: 1}
+	m.jobs[job.ID] = job
+	return job, nil
+}
+
+func (m *mockService) Job(ctx context.Context, id string) (models.Job, error) {
+	job, ok := m.jobs[id]
+	if !ok {
+		return models.Job{}, fmt.Errorf("%w: %s", models.ErrJobNotFound, id)
+	}
+	return job, nil
 }
 
 func TestServer_VerifyLinks_Success(t *testing.T) {
 	mockService := &mockService{
 		verifyLinksResponse: models.VerifyLinksResponse{
 			Links: map[string]string{"example.com": "available"},
-			Links_num: 1,
+			Links_num: "1",
 		},
 	}
 	
 	server := NewServer(slog.Default(), config.ServerConfig{
 		Host: "localhost",
 		Port: 8080,
-	}, mockService)
+	}, config.RateLimitConfig{}, mockService, nil)
 	
 	requestBody := models.VerifyLinksRequest{
 		Links: []string{"example.com"},
@@ -63,8 +177,8 @@ func TestServer_VerifyLinks_Success(t *testing.T) {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 	
-	if response.Links_num != 1 {
-		t.Errorf("Expected Links_num 1, got %d", response.Links_num)
+	if response.Links_num != "1" {
+		t.Errorf("Expected Links_num 1, got %s", response.Links_num)
 	}
 	
 	if response.Links["example.com"] != "available" {
@@ -77,7 +191,7 @@ func TestServer_VerifyLinks_EmptyBody(t *testing.T) {
 	server := NewServer(slog.Default(), config.ServerConfig{
 		Host: "localhost",
 		Port: 8080,
-	}, mockService)
+	}, config.RateLimitConfig{}, mockService, nil)
 	
 	req := httptest.NewRequest("POST", "/links", bytes.NewReader([]byte{}))
 	rr := httptest.NewRecorder()
@@ -97,7 +211,7 @@ func TestServer_VerifyLinks_ServiceError(t *testing.T) {
 	server := NewServer(slog.Default(), config.ServerConfig{
 		Host: "localhost",
 		Port: 8080,
-	}, mockService)
+	}, config.RateLimitConfig{}, mockService, nil)
 	
 	requestBody := models.VerifyLinksRequest{
 		Links: []string{"example.com"},
@@ -113,6 +227,43 @@ func TestServer_VerifyLinks_ServiceError(t *testing.T) {
 	if rr.Code != http.StatusInternalServerError {
 		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
 	}
+	var response models.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal error: %v", err)
+	}
+	if response.Error != "service error" || response.Code != http.StatusInternalServerError || response.Timestamp.IsZero() {
+		t.Errorf("Unexpected error response: %+v", response)
+	}
+}
+
+func TestServer_ErrorStatus(t *testing.T) {
+	tests := []struct {
+		err error
+		code int
+	}{
+		{models.ErrDecodingData, http.StatusBadRequest},
+		{models.ErrEmptyBody, http.StatusBadRequest},
+		{fmt.Errorf("%w: 7", models.ErrPackageNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: 3", models.ErrPackageExpired), http.StatusGone},
+		{fmt.Errorf("%w: 1001 > 1000", models.ErrTooManyLinks), http.StatusRequestEntityTooLarge},
+		{models.ErrShuttingDown, http.StatusServiceUnavailable},
+		{errors.New("StorageError"), http.StatusInternalServerError},
+	}
+	server := NewServer(slog.Default(), config.ServerConfig{}, config.RateLimitConfig{}, &mockService{}, nil)
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		server.writeError(rr, tt.err)
+		if rr.Code != tt.code {
+			t.Errorf("%v: expected status %d, got %d", tt.err, tt.code, rr.Code)
+		}
+		if rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%v: expected application/json, got '%s'", tt.err, rr.Header().Get("Content-Type"))
+		}
+		var response models.ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Code != tt.code || response.Error != tt.err.Error() {
+			t.Errorf("%v: unexpected error response %q", tt.err, rr.Body.String())
+		}
+	}
 }
 
 func TestServer_LinksReport(t *testing.T) {
@@ -123,10 +274,10 @@ func TestServer_LinksReport(t *testing.T) {
 	server := NewServer(slog.Default(), config.ServerConfig{
 		Host: "localhost",
 		Port: 8080,
-	}, mockService)
+	}, config.RateLimitConfig{}, mockService, nil)
 	
 	requestBody := models.LinksPackageRequest{
-		Links_list: []int{1},
+		Links_list: []models.PackageID{"1"},
 	}
 	data, _ := json.Marshal(requestBody)
 	
@@ -143,4 +294,480 @@ func TestServer_LinksReport(t *testing.T) {
 	if rr.Header().Get("Content-type") != "application/pdf" {
 		t.Errorf("Expected Content-type 'application/pdf', got '%s'", rr.Header().Get("Content-type"))
 	}
+
+	req = httptest.NewRequest("POST", "/links/list", bytes.NewReader(data))
+	req.Header.Set("Accept", "text/csv")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-type") != "text/csv; charset=utf-8" {
+		t.Errorf("Expected Content-type 'text/csv; charset=utf-8', got '%s'", rr.Header().Get("Content-type"))
+	}
+
+	req = httptest.NewRequest("POST", "/links/list", bytes.NewReader(data))
+	req.Header.Set("Accept", "image/png")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status %d, got %d", http.StatusNotAcceptable, rr.Code)
+	}
+}
+
+func TestServer_Webhooks(t *testing.T) {
+	mockService := &mockService{}
+	server := NewServer(slog.Default(), config.ServerConfig{
+		Host: "localhost",
+		Port: 8080,
+	}, config.RateLimitConfig{}, mockService, nil)
+	handler := server.GetHandler()
+
+	data, _ := json.Marshal(models.Webhook{URL: "https://hooks.example.com/links"})
+	req := httptest.NewRequest("POST", "/webhooks", bytes.NewReader(data))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/webhooks", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	var hooks []models.Webhook
+	if err := json.Unmarshal(rr.Body.Bytes(), &hooks); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(hooks) != 1 || hooks[0].ID != "hook1" {
+		t.Errorf("Expected registered webhook, got %+v", hooks)
+	}
+
+	req = httptest.NewRequest("DELETE", "/webhooks/hook1", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	req = httptest.NewRequest("DELETE", "/webhooks/hook1", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestServer_LinkUptime(t *testing.T) {
+	server := NewServer(slog.Default(), config.ServerConfig{
+		Host: "localhost",
+		Port: 8080,
+	}, config.RateLimitConfig{}, &mockService{}, nil)
+	handler := server.GetHandler()
+
+	req := httptest.NewRequest("GET", "/links/uptime?link=example.com&from=2025-11-01T00:00:00Z&to=2025-11-08T00:00:00Z", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var report models.UptimeReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if report.Link != "example.com" || report.To.Sub(report.From) != 7 * 24 * time.Hour {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	req = httptest.NewRequest("GET", "/links/uptime?link=example.com&from=yesterday", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestServer_Packages(t *testing.T) {
+	mockService := &mockService{
+		packages: map[models.PackageID]models.PackageResponse{
+			"1": {ID: "1", Links: []string{"example.com"}},
+			"2": {ID: "2", Links: []string{"google.com"}},
+			"0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6b": {ID: "0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6b"},
+		},
+	}
+	handler := NewServer(slog.Default(), config.ServerConfig{}, config.RateLimitConfig{}, mockService, nil).GetHandler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/packages/1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var pkg models.PackageResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &pkg); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if pkg.ID != "1" || len(pkg.Links) != 1 {
+		t.Errorf("Unexpected package: %+v", pkg)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/packages?link=google.com&limit=10", nil))
+	var page models.PackagesPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(page.Packages) != 1 || page.Packages[0].ID != "2" || page.Limit != 10 {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/packages?created_after=yesterday", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid filter, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("PUT", "/packages/2/pin", nil))
+	if rr.Code != http.StatusNoContent || !mockService.packages["2"].Pinned {
+		t.Errorf("Expected package 2 to be pinned, got status %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("DELETE", "/packages/2/pin", nil))
+	if rr.Code != http.StatusNoContent || mockService.packages["2"].Pinned {
+		t.Errorf("Expected package 2 to be unpinned, got status %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("DELETE", "/packages/1", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/packages/1", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after delete, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/packages/abc", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid id, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/packages/0192A3B4-C5D6-7E8F-9A0B-1C2D3E4F5A6B", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for a UUID, got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"id":"0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6b"`) {
+		t.Errorf("Expected the UUID as a JSON string, got %s", rr.Body.String())
+	}
+}
+
+func TestServer_VerifyLinks_Async(t *testing.T) {
+	mockService := &mockService{jobs: make(map[string]models.Job)}
+	handler := NewServer(slog.Default(), config.ServerConfig{}, config.RateLimitConfig{}, mockService, nil).GetHandler()
+	data, _ := json.Marshal(models.VerifyLinksRequest{Links: []string{"example.com"}})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/links?async=true", bytes.NewReader(data)),
+		func() *http.Request {
+			req := httptest.NewRequest("POST", "/links", bytes.NewReader(data))
+			req.Header.Set("Prefer", "respond-async, wait=10")
+			return req
+		}(),
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", http.StatusAccepted, rr.Code)
+		}
+		var job models.Job
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if rr.Header().Get("Location") != "/jobs/" + job.ID {
+			t.Errorf("Expected Location /jobs/%s, got '%s'", job.ID, rr.Header().Get("Location"))
+		}
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/jobs/" + job.ID, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/jobs/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestServer_StreamVerifyLinks(t *testing.T) {
+	mockService := &mockService{
+		verifyLinksResponse: models.VerifyLinksResponse{
+			Links_num: "7",
+			Results: map[string]models.LinkResult{
+				"example.com": {Status: models.StatusAvaliable},
+			},
+		},
+	}
+	handler := NewServer(slog.Default(), config.ServerConfig{}, config.RateLimitConfig{}, mockService, nil).GetHandler()
+	data, _ := json.Marshal(models.VerifyLinksRequest{Links: []string{"example.com"}})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/links/stream", bytes.NewReader(data)))
+	if rr.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got '%s'", rr.Header().Get("Content-Type"))
+	}
+	expected := "id: 1\nevent: result\ndata: {\"link\":\"example.com\",\"result\":{\"status\":\"avaliable\""
+	if !strings.HasPrefix(rr.Body.String(), expected) {
+		t.Errorf("Expected the stream to start with %q, got %q", expected, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "id: 2\nevent: summary\ndata: {\"links_num\":7,") {
+		t.Errorf("Expected a summary event, got %q", rr.Body.String())
+	}
+	if left := time.Until(mockService.streamDeadline); left <= 0 || left > requestTimeout {
+		t.Errorf("Expected the stream to end within %s, got a deadline in %s", requestTimeout, left)
+	}
+
+	req := httptest.NewRequest("POST", "/links/stream", bytes.NewReader(data))
+	req.Header.Set("Accept", "application/x-ndjson")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 NDJSON lines, got %q", rr.Body.String())
+	}
+	var summary struct {
+		Event string
+		Data models.StreamSummary
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &summary); err != nil {
+		t.Fatalf("Failed to unmarshal summary: %v", err)
+	}
+	if summary.Event != models.StreamEventSummary || summary.Data.Links_num != "7" || summary.Data.Summary.Available != 1 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	mockService.verifyLinksError = models.ErrDecodingData
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/links/stream", bytes.NewReader(data)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d before the stream starts, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestServer_Authorization(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(config.AuthConfig{Keys: []config.APIKey{
+		{Name: "ci", Hash: auth.HashKey("ci-key"), Scopes: []string{auth.ScopeVerify}},
+		{Name: "ops", Hash: auth.HashKey("ops-key"), Scopes: []string{auth.ScopeAdmin}},
+	}}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	mockService := &mockService{packages: map[models.PackageID]models.PackageResponse{"1": {ID: "1"}}}
+	handler := NewServer(slog.Default(), config.ServerConfig{}, config.RateLimitConfig{}, mockService, authenticator).GetHandler()
+
+	tests := []struct {
+		method string
+		path string
+		key string
+		code int
+	}{
+		{"POST", "/links", "", http.StatusUnauthorized},
+		{"POST", "/links", "wrong-key", http.StatusUnauthorized},
+		{"POST", "/links", "ci-key", http.StatusOK},
+		{"GET", "/packages/1", "ci-key", http.StatusForbidden},
+		{"DELETE", "/packages/1", "ci-key", http.StatusForbidden},
+		{"GET", "/packages/1", "ops-key", http.StatusOK},
+		{"GET", "/webhooks", "ops-key", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"links": ["example.com"]}`))
+		if tt.key != "" {
+			req.Header.Set(auth.HeaderAPIKey, tt.key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.code {
+			t.Errorf("%s %s with '%s': expected status %d, got %d", tt.method, tt.path, tt.key, tt.code, rr.Code)
+		}
+		if tt.code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s: expected a WWW-Authenticate header", tt.method, tt.path)
+		}
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	mockService := &mockService{}
+	server := NewServer(slog.Default(), config.ServerConfig{}, config.RateLimitConfig{
+		Rate: 1,
+		Burst: 2,
+		MaxLinksPerRequest: 3,
+		MaxLinksPerDay: 4,
+	}, mockService, nil)
+	now := time.Date(2025, 11, 29, 23, 59, 0, 0, time.UTC)
+	server.limiter.now = func() time.Time { return now }
+	handler := server.GetHandler()
+
+	verify := func(remoteAddr string, links ...string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(models.VerifyLinksRequest{Links: links})
+		req := httptest.NewRequest("POST", "/links", bytes.NewReader(data))
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := verify("10.0.0.1:1000", "a.com", "b.com"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr := verify("10.0.0.1:1001", "a.com", "b.com", "c.com", "d.com"); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d over the per-request quota, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	rr := verify("10.0.0.1:1002", "a.com")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected status %d with Retry-After 1 after the burst, got %d '%s'", http.StatusTooManyRequests, rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := verify("10.0.0.2:1000", "a.com"); rr.Code != http.StatusOK {
+		t.Errorf("Expected another client not to be limited, got %d", rr.Code)
+	}
+
+	now = now.Add(2 * time.Second)
+	rr = verify("10.0.0.1:1003", "a.com", "b.com", "c.com", "d.com")
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	rr = verify("10.0.0.1:1004", "a.com", "b.com", "c.com")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "58" {
+		t.Errorf("Expected status %d until the end of the day, got %d '%s'", http.StatusTooManyRequests, rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	now = now.Add(time.Minute)
+	if rr := verify("10.0.0.1:1005", "a.com", "b.com", "c.com"); rr.Code != http.StatusOK {
+		t.Errorf("Expected the daily quota to reset, got %d", rr.Code)
+	}
+
+	mockService.verifyLinksError = models.ErrTooManyLinks
+	if rr := verify("10.0.0.1:1006", "a.com"); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d from the service, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	mockService.verifyLinksError = nil
+	now = now.Add(2 * time.Second)
+	if rr := verify("10.0.0.1:1007", "a.com"); rr.Code != http.StatusOK {
+		t.Errorf("Expected the links of the failed request to be refunded, got %d", rr.Code)
+	}
+}
+
+func TestServer_RateLimitFailedAuth(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(config.AuthConfig{Keys: []config.APIKey{
+		{Name: "ci", Hash: auth.HashKey("ci-key"), Scopes: []string{auth.ScopeVerify}},
+	}}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	server := NewServer(slog.Default(), config.ServerConfig{}, config.RateLimitConfig{Rate: 1, Burst: 2}, &mockService{}, authenticator)
+	now := time.Date(2025, 11, 29, 12, 0, 0, 0, time.UTC)
+	server.limiter.now = func() time.Time { return now }
+	handler := server.GetHandler()
+
+	verify := func(remoteAddr, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/links", strings.NewReader(`{"links": ["example.com"]}`))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(auth.HeaderAPIKey, key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := range 2 {
+		if rr := verify("10.0.0.1:1000", "wrong-key"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status %d, got %d", i, http.StatusUnauthorized, rr.Code)
+		}
+	}
+	rr := verify("10.0.0.1:1001", "ci-key")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected status %d with Retry-After 1 after the failed attempts, got %d '%s'", http.StatusTooManyRequests, rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := verify("10.0.0.2:1000", "ci-key"); rr.Code != http.StatusOK {
+		t.Errorf("Expected another address not to be limited, got %d", rr.Code)
+	}
+
+	now = now.Add(time.Second)
+	for i := range 2 {
+		if rr := verify("10.0.0.1:1002", "ci-key"); rr.Code != http.StatusOK {
+			t.Errorf("Request %d: expected successful authentications not to take tokens of the address, got %d", i, rr.Code)
+		}
+	}
+}
+
+func TestServer_Metrics(t *testing.T) {
+	mockService := &mockService{packages: map[models.PackageID]models.PackageResponse{"1": {}}}
+	handler := NewServer(slog.Default(), config.ServerConfig{}, config.RateLimitConfig{}, mockService, nil).GetHandler()
+
+	before := requestsTotal.Value("GET /packages/{id}", "GET", "404")
+	for _, path := range []string{"/packages/1", "/packages/2", "/packages/3"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	if got := requestsTotal.Value("GET /packages/{id}", "GET", "404") - before; got != 2 {
+		t.Errorf("Expected 2 requests counted by route and code, got %v", got)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Expected the text exposition format, got %d '%s'", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{route="GET /packages/{id}",method="GET",code="200"}`,
+		`http_request_duration_seconds_bucket{route="GET /packages/{id}",method="GET",le="+Inf"}`,
+	} {
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Errorf("Expected '%s' in the metrics, got:\n%s", line, rr.Body.String())
+		}
+	}
+}
+
+func TestServer_Health(t *testing.T) {
+	server := NewServer(slog.Default(), config.ServerConfig{Host: "127.0.0.1"}, config.RateLimitConfig{}, &mockService{}, nil)
+	var serviceErr error
+	server.AddReadinessCheck("service", func() error { return serviceErr })
+	handler := server.GetHandler()
+
+	ready := func() (int, models.HealthResponse) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+		var res models.HealthResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatalf("Failed to decode readiness: %v", err)
+		}
+		return rr.Code, res
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d from /healthz, got %d", http.StatusOK, rr.Code)
+	}
+	if code, res := ready(); code != http.StatusServiceUnavailable || res.Checks["server"] != errNotListening.Error() {
+		t.Errorf("Expected not ready before Start, got %d %+v", code, res)
+	}
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer server.Shutdown(context.Background())
+	if code, res := ready(); code != http.StatusOK || res.Status != models.HealthOK {
+		t.Errorf("Expected ready after Start, got %d %+v", code, res)
+	}
+
+	serviceErr = models.ErrShuttingDown
+	if code, res := ready(); code != http.StatusServiceUnavailable || res.Checks["service"] != models.ErrShuttingDown.Error() || res.Checks["server"] != models.HealthOK {
+		t.Errorf("Expected the failing check reported, got %d %+v", code, res)
+	}
+	serviceErr = nil
+	server.Drain()
+	if code, res := ready(); code != http.StatusServiceUnavailable || res.Status != models.HealthUnavailable {
+		t.Errorf("Expected not ready while draining, got %d %+v", code, res)
+	}
 }
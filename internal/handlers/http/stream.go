@@ -0,0 +1,96 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	contentTypeSSE = "text/event-stream"
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
+// eventStream writes events as Server-Sent Events or as NDJSON, where every
+// line is {"event": ..., "data": ...}. Headers are sent with the first event,
+// so an error before it can still be answered with a plain status code.
+type eventStream struct {
+	writer http.ResponseWriter
+	controller *http.ResponseController
+	log *slog.Logger
+	ndjson bool
+	started bool
+	id int
+}
+
+type ndjsonEvent struct {
+	Event string `json:"event"`
+	Data any `json:"data"`
+}
+
+func newEventStream(writer http.ResponseWriter, request *http.Request, log *slog.Logger) *eventStream {
+	return &eventStream{
+		writer: writer,
+		controller: http.NewResponseController(writer),
+		log: log,
+		ndjson: wantsNDJSON(request),
+	}
+}
+
+func(s *eventStream) send(event string, data any) {
+	if !s.started {
+		s.start()
+	}
+	s.id++
+
+	var err error
+	if s.ndjson {
+		var line []byte
+		line, err = json.Marshal(ndjsonEvent{Event: event, Data: data})
+		if err == nil {
+			_, err = s.writer.Write(append(line, '\n'))
+		}
+	} else {
+		var payload []byte
+		payload, err = json.Marshal(data)
+		if err == nil {
+			_, err = fmt.Fprintf(s.writer, "id: %d\nevent: %s\ndata: %s\n\n", s.id, event, payload)
+		}
+	}
+	if err == nil {
+		err = s.controller.Flush()
+	}
+	if err != nil {
+		s.log.Error(
+			"WritingEventError",
+			slog.String("component", "http/stream"),
+			slog.String("event", event),
+			slog.Any("error", err),
+		)
+	}
+}
+
+func(s *eventStream) start() {
+	s.started = true
+	contentType := contentTypeSSE
+	if s.ndjson {
+		contentType = contentTypeNDJSON
+	}
+	s.writer.Header().Set("Content-Type", contentType)
+	s.writer.Header().Set("Cache-Control", "no-cache")
+	// Ask reverse proxies such as nginx not to buffer the stream.
+	s.writer.Header().Set("X-Accel-Buffering", "no")
+	s.writer.WriteHeader(http.StatusOK)
+}
+
+// wantsNDJSON picks NDJSON with "?format=ndjson" or an Accept header that
+// names it; Server-Sent Events are the default.
+func wantsNDJSON(request *http.Request) bool {
+	if format := request.URL.Query().Get("format"); format != "" {
+		return strings.EqualFold(format, "ndjson")
+	}
+	accept := request.Header.Get("Accept")
+	return strings.Contains(accept, contentTypeNDJSON) || strings.Contains(accept, "application/jsonl")
+}
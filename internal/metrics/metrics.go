@@ -0,0 +1,288 @@
+// Package metrics keeps counters, histograms and gauges and exposes them in
+// the Prometheus text exposition format, version 0.0.4.
+//
+// Metrics are registered in one registry for the process, usually as package
+// variables of the component that updates them.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets suit latencies in seconds, from 5 ms to 10 s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+type registry struct {
+	mutex sync.RWMutex
+	names []string
+	metrics map[string]metric
+}
+
+var defaultRegistry = &registry{metrics: make(map[string]metric)}
+
+// register adds the metric. Names are unique unless replace is set, which
+// swaps the old metric for the new one.
+func(r *registry) register(name string, m metric, replace bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.metrics[name]; ok {
+		if !replace {
+			panic("metrics: duplicate metric " + name)
+		}
+	} else {
+		r.names = append(r.names, name)
+	}
+	r.metrics[name] = m
+}
+
+func(r *registry) write(w io.Writer) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	buffer := bufio.NewWriter(w)
+	names := slices.Clone(r.names)
+	slices.Sort(names)
+	for _, name := range names {
+		r.metrics[name].write(buffer)
+	}
+	return buffer.Flush()
+}
+
+// WriteTo writes every registered metric, sorted by name.
+func WriteTo(w io.Writer) error {
+	return defaultRegistry.write(w)
+}
+
+// Handler serves the registered metrics to Prometheus.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", ContentType)
+		WriteTo(writer)
+	})
+}
+
+// series is the set of label values of a vector, kept with the values.
+type series[T any] struct {
+	mutex sync.Mutex
+	labels []string
+	values map[string]*T
+	order map[string][]string
+}
+
+func newSeries[T any](labels []string) series[T] {
+	return series[T]{
+		labels: labels,
+		values: make(map[string]*T),
+		order: make(map[string][]string),
+	}
+}
+
+// get returns the value of the label values, creating it with create. The
+// caller must hold s.mutex.
+func(s *series[T]) get(values []string, create func() *T) *T {
+	if len(values) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(s.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	value, ok := s.values[key]
+	if !ok {
+		value = create()
+		s.values[key] = value
+		s.order[key] = slices.Clone(values)
+	}
+	return value
+}
+
+// sortedKeys returns the series keys in label order. The caller must hold s.mutex.
+func(s *series[T]) sortedKeys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	name string
+	help string
+	series series[float64]
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	counter := &CounterVec{name: name, help: help, series: newSeries[float64](labels)}
+	defaultRegistry.register(name, counter, false)
+	return counter
+}
+
+func(c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increases the counter of the label values. delta must not be negative.
+func(c *CounterVec) Add(delta float64, values ...string) {
+	c.series.mutex.Lock()
+	defer c.series.mutex.Unlock()
+	*c.series.get(values, func() *float64 { return new(float64) }) += delta
+}
+
+// Value returns the counter of the label values.
+func(c *CounterVec) Value(values ...string) float64 {
+	c.series.mutex.Lock()
+	defer c.series.mutex.Unlock()
+	if value, ok := c.series.values[strings.Join(values, "\xff")]; ok {
+		return *value
+	}
+	return 0
+}
+
+func(c *CounterVec) write(w *bufio.Writer) {
+	c.series.mutex.Lock()
+	defer c.series.mutex.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range c.series.sortedKeys() {
+		writeSample(w, c.name, c.series.labels, c.series.order[key], "", "", *c.series.values[key])
+	}
+}
+
+type histogram struct {
+	// counts are per bucket, not cumulative; the last one is +Inf.
+	counts []uint64
+	sum float64
+	count uint64
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	name string
+	help string
+	buckets []float64
+	series series[histogram]
+}
+
+// NewHistogramVec uses DefaultBuckets if buckets is nil.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	histogram := &HistogramVec{name: name, help: help, buckets: buckets, series: newSeries[histogram](labels)}
+	defaultRegistry.register(name, histogram, false)
+	return histogram
+}
+
+func(h *HistogramVec) Observe(value float64, values ...string) {
+	h.series.mutex.Lock()
+	defer h.series.mutex.Unlock()
+
+	hist := h.series.get(values, func() *histogram {
+		return &histogram{counts: make([]uint64, len(h.buckets) + 1)}
+	})
+	i, _ := slices.BinarySearch(h.buckets, value)
+	hist.counts[i]++
+	hist.sum += value
+	hist.count++
+}
+
+func(h *HistogramVec) write(w *bufio.Writer) {
+	h.series.mutex.Lock()
+	defer h.series.mutex.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range h.series.sortedKeys() {
+		hist := h.series.values[key]
+		values := h.series.order[key]
+		var cumulative uint64
+		for i, count := range hist.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			writeSample(w, h.name + "_bucket", h.series.labels, values, "le", formatFloat(le), float64(cumulative))
+		}
+		writeSample(w, h.name + "_sum", h.series.labels, values, "", "", hist.sum)
+		writeSample(w, h.name + "_count", h.series.labels, values, "", "", float64(hist.count))
+	}
+}
+
+type gaugeFunc struct {
+	name string
+	help string
+	value func() float64
+}
+
+// NewGaugeFunc registers a gauge read from value on every scrape. Registering
+// the name again replaces the function, so a recreated component takes over.
+func NewGaugeFunc(name, help string, value func() float64) {
+	defaultRegistry.register(name, &gaugeFunc{name: name, help: help, value: value}, true)
+}
+
+func(g *gaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, nil, nil, "", "", g.value())
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes one line; extraLabel, if set, is appended to the labels.
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) != 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, label, values[i])
+		}
+		if extraLabel != "" {
+			if len(labels) != 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func writeLabel(w *bufio.Writer, label, value string) {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	fmt.Fprintf(w, `%s="%s"`, label, value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	counter := NewCounterVec("test_requests_total", "Requests.\nBy path.", "path")
+	counter.Inc(`/a"b`)
+	counter.Add(2, "/")
+	histogram := NewHistogramVec("test_duration_seconds", "Duration.", []float64{1, 0.5})
+	histogram.Observe(0.25)
+	histogram.Observe(0.75)
+	histogram.Observe(3)
+	NewGaugeFunc("test_entries", "Entries.", func() float64 { return 1 })
+	NewGaugeFunc("test_entries", "Entries.", func() float64 { return 7 })
+
+	var out strings.Builder
+	if err := WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	expected := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.5"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 4
+test_duration_seconds_count 3
+# HELP test_entries Entries.
+# TYPE test_entries gauge
+test_entries 7
+# HELP test_requests_total Requests.\nBy path.
+# TYPE test_requests_total counter
+test_requests_total{path="/"} 2
+test_requests_total{path="/a\"b"} 1
+`
+	if out.String() != expected {
+		t.Errorf("Unexpected exposition:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+	if counter.Value("/") != 2 || counter.Value("/missing") != 0 {
+		t.Errorf("Unexpected counter values %v and %v", counter.Value("/"), counter.Value("/missing"))
+	}
+}
+
+func TestNewCounterVec_Duplicate(t *testing.T) {
+	NewCounterVec("test_duplicate_total", "Duplicate.")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for a duplicate metric")
+		}
+	}()
+	NewCounterVec("test_duplicate_total", "Duplicate.")
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Errors of invalid requests. The HTTP layer answers them with 400, except
+// ErrTooManyLinks which is 413.
+var (
+	ErrDecodingData = errors.New("DecodingDataError")
+	ErrEmptyBody = errors.New("EmptyBody")
+	ErrEmptyLink = errors.New("EmptyLink")
+	ErrInvalidTimeWindow = errors.New("InvalidTimeWindow")
+	ErrInvalidPagination = errors.New("InvalidPagination")
+	ErrTooManyLinks = errors.New("TooManyLinks")
+)
+
+// ErrShuttingDown is returned for requests that arrive after Shutdown started.
+var ErrShuttingDown = errors.New("ServiceIsShuttingDown")
+
+// ErrorResponse is the body of every error response of the API.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Code repeats the HTTP status code.
+	Code int `json:"code"`
+	Timestamp time.Time `json:"timestamp"`
+}
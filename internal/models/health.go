@@ -0,0 +1,13 @@
+package models
+
+const (
+	HealthOK = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// HealthResponse is the body of /healthz and /readyz.
+type HealthResponse struct {
+	Status string `json:"status"`
+	// Checks maps every readiness check to "ok" or the reason it failed.
+	Checks map[string]string `json:"checks,omitempty"`
+}
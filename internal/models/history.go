@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// HistoryPoint is a check result in the link history. Old points are
+// downsampled: then Time is the start of the bucket, Checks and Up count the
+// checks in it and LatencyMS is their average.
+type HistoryPoint struct {
+	Time time.Time `json:"time"`
+	Checks int `json:"checks"`
+	Up int `json:"up"`
+	LatencyMS int64 `json:"latency_ms"`
+	MaxLatencyMS int64 `json:"max_latency_ms"`
+	// StatusCode and ErrorClass are those of the last check of the point.
+	StatusCode int `json:"status_code,omitempty"`
+	ErrorClass string `json:"error_class,omitempty"`
+}
+
+func(p HistoryPoint) Down() bool {
+	return p.Up < p.Checks
+}
+
+type UptimeReport struct {
+	Link string `json:"link"`
+	From time.Time `json:"from"`
+	To time.Time `json:"to"`
+	Checks int `json:"checks"`
+	// UptimePercent is the share of successful checks; it is 0 without checks.
+	UptimePercent float64 `json:"uptime_percent"`
+	// Incidents counts the periods in which the link was down.
+	Incidents int `json:"incidents"`
+	LatencyP50MS int64 `json:"latency_p50_ms"`
+	LatencyP90MS int64 `json:"latency_p90_ms"`
+	LatencyP99MS int64 `json:"latency_p99_ms"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	JobRunning = "running"
+	JobDone = "done"
+	JobFailed = "failed"
+)
+
+var (
+	ErrJobNotFound = errors.New("JobNotFound")
+	ErrTooManyJobs = errors.New("TooManyJobs")
+)
+
+// Job is an asynchronous verification of a list of links.
+type Job struct {
+	ID string `json:"id"`
+	Status string `json:"status"`
+	// Done and Total count the unique canonical links of the request.
+	Done int `json:"done"`
+	Total int `json:"total"`
+	// Results holds the results known so far, keyed by canonical key.
+	Results map[string]LinkResult `json:"results"`
+	// Response is set once the job is done. Its results are in Results.
+	Response *VerifyLinksResponse `json:"response,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Owner is the client that submitted the job, empty without authentication.
+	Owner string `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+func(j Job) Finished() bool {
+	return j.Status != JobRunning
+}
@@ -1,14 +1,112 @@
 package models
 
+import "time"
+
+const (
+	StatusAvaliable = "avaliable"
+	StatusNotAvaliable = "not avaliable"
+	// StatusCancelled and StatusTimedOut mark links whose check was interrupted
+	// before it finished, so their availability is unknown.
+	StatusCancelled = "cancelled"
+	StatusTimedOut = "timed out"
+)
+
+// Error classes of a failed link check.
+const (
+	ErrorClassDNS = "dns"
+	ErrorClassConnectionRefused = "connection_refused"
+	ErrorClassTLS = "tls"
+	ErrorClassTimeout = "timeout"
+	ErrorClassHTTPStatus = "http_status"
+	ErrorClassTooManyRedirects = "too_many_redirects"
+	ErrorClassCancelled = "cancelled"
+	ErrorClassInvalidURL = "invalid_url"
+	// ErrorClassAssertion marks a response that failed an assertion of its check rule.
+	ErrorClassAssertion = "assertion"
+	ErrorClassOther = "other"
+)
+
+// Assertions a response can fail, reported in LinkResult.FailedAssertion.
+const (
+	AssertionMaxLatency = "max_latency"
+	AssertionHeader = "header"
+	AssertionMaxBodySize = "max_body_size"
+	AssertionBodyContains = "body_contains"
+	AssertionBodyNotContains = "body_not_contains"
+	AssertionBodyMatches = "body_matches"
+	AssertionJSONPath = "json_path"
+)
+
 type VerifyLinksRequest struct {
 	Links []string
+	// MaxAge, in seconds, limits the age of cached statuses in the response.
+	// Older ones are checked again; 0 forces a fresh check of every link.
+	MaxAge *int `json:"max_age,omitempty"`
 }
 
 type VerifyLinksResponse struct {
+	// Links maps every submitted link to its status.
 	Links map[string]string
-	Links_num int
+	// Links_num is the ID of the package the links were stored in.
+	Links_num PackageID
+	// Results is keyed by the canonical keys from Canonical.
+	Results map[string]LinkResult
+	// Canonical maps every submitted link to its canonical key.
+	Canonical map[string]string
 }
 
 type LinksPackageRequest struct {
-	Links_list []int
-}
\ No newline at end of file
+	// Links_list holds the package IDs, numbers or opaque strings.
+	Links_list []PackageID
+	// Format of the report: pdf, csv, json, html or markdown. It takes
+	// precedence over the Accept header.
+	Format string `json:"format,omitempty"`
+}
+
+// LinkResult is the outcome of a single link check.
+type LinkResult struct {
+	// Status is derived from the other fields and kept for clients
+	// that only understand "avaliable"/"not avaliable".
+	Status string `json:"status"`
+	StatusCode int `json:"status_code,omitempty"`
+	FinalURL string `json:"final_url,omitempty"`
+	// Scheme is the scheme of the last attempt: the one that answered if any did.
+	Scheme string `json:"scheme,omitempty"`
+	// Method is the method of the last request, GET after a rejected HEAD.
+	Method string `json:"method,omitempty"`
+	// Redirects are the redirect responses on the way to FinalURL, in order.
+	Redirects []Redirect `json:"redirects,omitempty"`
+	LatencyMS int64 `json:"latency_ms"`
+	ErrorClass string `json:"error_class,omitempty"`
+	// FailedAssertion is the first assertion the response failed; Error
+	// describes how.
+	FailedAssertion string `json:"failed_assertion,omitempty"`
+	Error string `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	FromCache bool `json:"from_cache"`
+}
+
+// Redirect is a response that redirected a check.
+type Redirect struct {
+	URL string `json:"url"`
+	StatusCode int `json:"status_code"`
+	Location string `json:"location"`
+}
+
+func(r LinkResult) Available() bool {
+	return r.Status == StatusAvaliable
+}
+
+// Interrupted reports whether the check didn't finish. Such results must not be cached.
+func(r LinkResult) Interrupted() bool {
+	return r.Status == StatusCancelled || r.Status == StatusTimedOut
+}
+
+// Statuses returns the backwards compatible link -> status view of results.
+func Statuses(results map[string]LinkResult) map[string]string {
+	res := make(map[string]string, len(results))
+	for link, result := range results {
+		res[link] = result.Status
+	}
+	return res
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPackageID = errors.New("InvalidPackageID")
+
+// PackageID identifies a stored package: a sequential number or an opaque
+// UUIDv7. Sequential IDs are written to JSON as numbers, as they always were;
+// both forms are read from JSON numbers and strings.
+type PackageID string
+
+func NumericPackageID(id int) PackageID {
+	return PackageID(strconv.Itoa(id))
+}
+
+// ParsePackageID accepts a positive number or a UUID in its canonical form.
+func ParsePackageID(s string) (PackageID, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 {
+			return "", fmt.Errorf("%w: %s", ErrInvalidPackageID, s)
+		}
+		return NumericPackageID(n), nil
+	}
+	if !isUUID(s) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidPackageID, s)
+	}
+	return PackageID(strings.ToLower(s)), nil
+}
+
+// Numeric returns the number of a sequential ID.
+func(id PackageID) Numeric() (int, bool) {
+	n, err := strconv.Atoi(string(id))
+	return n, err == nil
+}
+
+func(id PackageID) MarshalJSON() ([]byte, error) {
+	if _, ok := id.Numeric(); ok {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+func(id *PackageID) UnmarshalJSON(data []byte) error {
+	var s string
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	} else {
+		s = string(data)
+	}
+	parsed, err := ParsePackageID(s)
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// ComparePackageIDs orders sequential IDs by number before opaque ones, which
+// UUIDv7 orders by creation time.
+func ComparePackageIDs(a, b PackageID) int {
+	an, aNumeric := a.Numeric()
+	bn, bNumeric := b.Numeric()
+	switch {
+	case aNumeric && bNumeric:
+		return cmp.Compare(an, bn)
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	}
+	return strings.Compare(string(a), string(b))
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
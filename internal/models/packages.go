@@ -0,0 +1,64 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrPackageNotFound = errors.New("PackageNotFound")
+
+// ErrPackageExpired is returned for packages evicted by the retention policy.
+var ErrPackageExpired = errors.New("PackageExpired")
+
+// ErrPackageStoreFull is returned for new packages when every stored one is
+// pinned and the store is at its limit.
+var ErrPackageStoreFull = errors.New("PackageStoreIsFull")
+
+// LinksPackage is a stored list of canonical link keys.
+type LinksPackage struct {
+	ID PackageID `json:"id"`
+	Links []string `json:"links"`
+	CreatedAt time.Time `json:"created_at"`
+	// Owner is the client that created the package, as "key:<name>" or
+	// "jwt:<subject>", empty without authentication.
+	Owner string `json:"owner,omitempty"`
+	// Pinned packages are kept regardless of the retention policy.
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// PackageFilter selects stored packages. Zero fields match every package.
+type PackageFilter struct {
+	// Link matches the packages containing the link.
+	Link string
+	// Owner matches the packages created by the client.
+	Owner string
+	CreatedAfter time.Time
+	CreatedBefore time.Time
+	Offset int
+	Limit int
+}
+
+// PackageResponse is a stored package with the last known status of its links.
+type PackageResponse struct {
+	ID PackageID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Pinned bool `json:"pinned,omitempty"`
+	Links []string `json:"links"`
+	// Results has no entry for links that were never checked.
+	Results map[string]LinkResult `json:"results"`
+}
+
+type PackageSummary struct {
+	ID PackageID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Pinned bool `json:"pinned,omitempty"`
+	LinksNum int `json:"links_num"`
+}
+
+type PackagesPage struct {
+	Packages []PackageSummary `json:"packages"`
+	// Total is the number of packages matching the filter.
+	Total int `json:"total"`
+	Offset int `json:"offset"`
+	Limit int `json:"limit"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrUnsupportedFormat = errors.New("UnsupportedFormat")
+
+// Report is the package report every output format is rendered from.
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	PackageIDs []PackageID `json:"package_ids"`
+	Summary ReportSummary `json:"summary"`
+	// Links holds every link of the packages once, sorted by link.
+	Links []ReportLink `json:"links"`
+	Packages []ReportPackage `json:"packages"`
+}
+
+type ReportSummary struct {
+	Total int `json:"total"`
+	Available int `json:"available"`
+	NotAvailable int `json:"not_available"`
+	// Interrupted counts the links whose check didn't finish.
+	Interrupted int `json:"interrupted"`
+}
+
+// Summarize counts the results by outcome.
+func Summarize(results map[string]LinkResult) ReportSummary {
+	summary := ReportSummary{Total: len(results)}
+	for _, result := range results {
+		switch {
+		case result.Available():
+			summary.Available++
+		case result.Interrupted():
+			summary.Interrupted++
+		default:
+			summary.NotAvailable++
+		}
+	}
+	return summary
+}
+
+type ReportLink struct {
+	Link string `json:"link"`
+	Result LinkResult `json:"result"`
+}
+
+type ReportPackage struct {
+	ID PackageID `json:"id"`
+	// Links are sorted canonical keys; their results are in Report.Links.
+	Links []string `json:"links"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// Event names of the streaming verification.
+const (
+	StreamEventResult = "result"
+	StreamEventSummary = "summary"
+	StreamEventError = "error"
+)
+
+// StreamResult is sent for every link as soon as its result is known.
+type StreamResult struct {
+	// Link is the canonical key; the summary maps submitted links to keys.
+	Link string `json:"link"`
+	Result LinkResult `json:"result"`
+}
+
+// StreamSummary ends the stream once every link is done.
+type StreamSummary struct {
+	Links_num PackageID `json:"links_num"`
+	Summary ReportSummary `json:"summary"`
+	Canonical map[string]string `json:"canonical"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	EventLinkDown = "link.down"
+	EventLinkUp = "link.up"
+)
+
+// Webhook is an endpoint notified about link status changes.
+type Webhook struct {
+	ID string `json:"id"`
+	URL string `json:"url"`
+	// Events the endpoint is subscribed to; empty means all of them.
+	Events []string `json:"events,omitempty"`
+	// Secret signs the payloads. It is never returned by the API.
+	Secret string `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StatusChangeEvent is the payload sent when a link goes up or down.
+type StatusChangeEvent struct {
+	ID string `json:"id"`
+	Type string `json:"type"`
+	Link string `json:"link"`
+	OldStatus string `json:"old_status"`
+	NewStatus string `json:"new_status"`
+	PreviousCheckedAt time.Time `json:"previous_checked_at"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Packages contains the IDs of the link packages with the link.
+	Packages []PackageID `json:"packages"`
+	Result LinkResult `json:"result"`
+}
+
+// WebhookDelivery is an entry of the delivery log.
+type WebhookDelivery struct {
+	ID string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	EventID string `json:"event_id"`
+	EventType string `json:"event_type"`
+	Link string `json:"link"`
+	Attempts int `json:"attempts"`
+	Delivered bool `json:"delivered"`
+	StatusCode int `json:"status_code,omitempty"`
+	Error string `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+}
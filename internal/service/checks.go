@@ -0,0 +1,247 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+// defaultCheckedBodySize is how much of the body the body assertions see when
+// the rule sets no max_body_size.
+const defaultCheckedBodySize = 1 << 20
+
+// checkRule holds the assertions of the links whose canonical key matches pattern.
+type checkRule struct {
+	pattern *regexp.Regexp
+	// acceptedStatuses, if set, replace the ones of the service.
+	acceptedStatuses statusRanges
+	bodyContains []string
+	bodyNotContains []string
+	bodyMatches *regexp.Regexp
+	json []jsonAssertion
+	headers map[string]string
+	maxBodySize int64
+	maxLatency time.Duration
+}
+
+type jsonAssertion struct {
+	path string
+	// keys are the object keys (string) and array indices (int) of the path.
+	keys []any
+	// equals is the expected value as decoded from JSON, to compare with
+	// values of the body.
+	equals any
+}
+
+// failedAssertion is the first assertion a response failed.
+type failedAssertion struct {
+	assertion string
+	reason string
+}
+
+// newCheckRules compiles the configured rules, failing on the first invalid one.
+func newCheckRules(cfg []config.CheckRule) ([]*checkRule, error) {
+	rules := make([]*checkRule, 0, len(cfg))
+	for _, c := range cfg {
+		rule, err := newCheckRule(c)
+		if err != nil {
+			return nil, fmt.Errorf("InvalidCheckRule: %s: %w", c.Pattern, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func newCheckRule(cfg config.CheckRule) (*checkRule, error) {
+	pattern, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxBodySize < 0 || cfg.MaxLatency < 0 {
+		return nil, errors.New("NegativeLimit")
+	}
+	rule := &checkRule{
+		pattern: pattern,
+		bodyContains: cfg.BodyContains,
+		bodyNotContains: cfg.BodyNotContains,
+		headers: cfg.Headers,
+		maxBodySize: cfg.MaxBodySize,
+		maxLatency: cfg.MaxLatency,
+	}
+	if len(cfg.AcceptedStatuses) != 0 {
+		if rule.acceptedStatuses, err = parseStatusRanges(cfg.AcceptedStatuses); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.BodyMatches != "" {
+		if rule.bodyMatches, err = regexp.Compile(cfg.BodyMatches); err != nil {
+			return nil, err
+		}
+	}
+	for _, assertion := range cfg.JSON {
+		keys, err := parseJSONPath(assertion.Path)
+		if err != nil {
+			return nil, err
+		}
+		// Round trip the YAML value, so numbers compare as float64 like the body ones.
+		data, err := json.Marshal(assertion.Equals)
+		if err != nil {
+			return nil, err
+		}
+		var equals any
+		json.Unmarshal(data, &equals)
+		rule.json = append(rule.json, jsonAssertion{path: assertion.Path, keys: keys, equals: equals})
+	}
+	return rule, nil
+}
+
+// checkRuleFor returns the first rule matching the link, or nil.
+func(svc *LinkService) checkRuleFor(link string) *checkRule {
+	for _, rule := range svc.checks {
+		if rule.pattern.MatchString(link) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// readsBody reports whether the assertions need the response body.
+func(r *checkRule) readsBody() bool {
+	return len(r.bodyContains) != 0 || len(r.bodyNotContains) != 0 || r.bodyMatches != nil ||
+		len(r.json) != 0 || r.maxBodySize > 0
+}
+
+// bodyLimit is how much of the body is read: one byte over max_body_size to
+// tell that it is exceeded.
+func(r *checkRule) bodyLimit() int64 {
+	if r.maxBodySize > 0 {
+		return r.maxBodySize + 1
+	}
+	return defaultCheckedBodySize
+}
+
+// check applies the assertions to the response, its body as read up to
+// bodyLimit and the latency until its headers.
+func(r *checkRule) check(resp *http.Response, body []byte, latency time.Duration) *failedAssertion {
+	if r.maxLatency > 0 && latency > r.maxLatency {
+		return &failedAssertion{models.AssertionMaxLatency, fmt.Sprintf("latency %s exceeds %s", latency.Round(time.Millisecond), r.maxLatency)}
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.headers)) {
+		value := r.headers[name]
+		values, ok := resp.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return &failedAssertion{models.AssertionHeader, fmt.Sprintf("header %s is missing", name)}
+		}
+		if value != "" && !slices.Contains(values, value) {
+			return &failedAssertion{models.AssertionHeader, fmt.Sprintf("header %s is %q, not %q", name, strings.Join(values, ", "), value)}
+		}
+	}
+	if r.maxBodySize > 0 && int64(len(body)) > r.maxBodySize {
+		return &failedAssertion{models.AssertionMaxBodySize, fmt.Sprintf("body exceeds %d bytes", r.maxBodySize)}
+	}
+	for _, s := range r.bodyContains {
+		if !bytes.Contains(body, []byte(s)) {
+			return &failedAssertion{models.AssertionBodyContains, fmt.Sprintf("body does not contain %q", s)}
+		}
+	}
+	for _, s := range r.bodyNotContains {
+		if bytes.Contains(body, []byte(s)) {
+			return &failedAssertion{models.AssertionBodyNotContains, fmt.Sprintf("body contains %q", s)}
+		}
+	}
+	if r.bodyMatches != nil && !r.bodyMatches.Match(body) {
+		return &failedAssertion{models.AssertionBodyMatches, fmt.Sprintf("body does not match %q", r.bodyMatches)}
+	}
+	if len(r.json) == 0 {
+		return nil
+	}
+	var document any
+	if err := json.Unmarshal(body, &document); err != nil {
+		return &failedAssertion{models.AssertionJSONPath, "body is not JSON: " + err.Error()}
+	}
+	for _, assertion := range r.json {
+		value, ok := lookupJSONPath(document, assertion.keys)
+		if !ok {
+			return &failedAssertion{models.AssertionJSONPath, fmt.Sprintf("%s is missing", assertion.path)}
+		}
+		if !reflect.DeepEqual(value, assertion.equals) {
+			got, _ := json.Marshal(value)
+			expected, _ := json.Marshal(assertion.equals)
+			return &failedAssertion{models.AssertionJSONPath, fmt.Sprintf("%s is %s, not %s", assertion.path, got, expected)}
+		}
+	}
+	return nil
+}
+
+// parseJSONPath splits a path like "$.data.items[0].id" into its keys. The
+// leading "$" is optional.
+func parseJSONPath(path string) ([]any, error) {
+	rest := strings.TrimPrefix(path, "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+	keys := make([]any, 0)
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("InvalidJSONPath: %s", path)
+			}
+			keys = append(keys, rest[1:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("InvalidJSONPath: %s", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("InvalidJSONPath: %s", path)
+			}
+			keys = append(keys, index)
+			rest = rest[end + 1:]
+		default:
+			return nil, fmt.Errorf("InvalidJSONPath: %s", path)
+		}
+	}
+	return keys, nil
+}
+
+func lookupJSONPath(document any, keys []any) (any, bool) {
+	value := document
+	for _, key := range keys {
+		switch key := key.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[key]; !ok {
+				return nil, false
+			}
+		case int:
+			array, ok := value.([]any)
+			if !ok || key >= len(array) {
+				return nil, false
+			}
+			value = array[key]
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/auth"
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+const (
+	defaultJobRetention = time.Hour
+	defaultMaxJobs = 1000
+	maxJobsSweepInterval = time.Minute
+)
+
+// jobManager keeps the asynchronous verification jobs. Finished jobs are
+// removed once they are older than the retention.
+type jobManager struct {
+	mutex sync.RWMutex
+	jobs map[string]*models.Job
+	retention time.Duration
+	maxJobs int
+}
+
+func newJobManager(cfg config.JobsConfig) *jobManager {
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaultJobRetention
+	}
+	if cfg.MaxJobs <= 0 {
+		cfg.MaxJobs = defaultMaxJobs
+	}
+	return &jobManager{
+		jobs: make(map[string]*models.Job),
+		retention: cfg.Retention,
+		maxJobs: cfg.MaxJobs,
+	}
+}
+
+// SubmitVerifyJob starts the verification of the links in the background and
+// returns the job to poll with Job.
+func(svc *LinkService) SubmitVerifyJob(ctx context.Context, data []byte) (models.Job, error) {
+	linksRequest, err := svc.verifyRequest(data)
+	if err != nil {
+		return models.Job{}, err
+	}
+	_, keys := canonicalKeys(linksRequest.Links)
+	job, err := svc.jobs.create(len(keys), packageOwner(ctx))
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	// The job outlives the request, but its package belongs to the same client.
+	jobCtx := svc.ctx
+	if principal, ok := auth.FromContext(ctx); ok {
+		jobCtx = auth.WithPrincipal(jobCtx, principal)
+	}
+	go func() {
+		progress := func(link string, result models.LinkResult) {
+			svc.jobs.update(job.ID, func(job *models.Job) {
+				if _, ok := job.Results[link]; !ok {
+					job.Done++
+				}
+				job.Results[link] = result
+			})
+		}
+		res, err := svc.verifyLinks(jobCtx, linksRequest, progress)
+		svc.jobs.finish(job.ID, res, err)
+		if err != nil {
+			svc.log.Error(
+				"VerifyJobError",
+				slog.String("component", "jobs"),
+				slog.String("job", job.ID),
+				slog.Any("error", err),
+			)
+		}
+	}()
+	return job, nil
+}
+
+// Job returns the job if the client of ctx may read it. The jobs of other
+// clients are reported as not found, like their packages.
+func(svc *LinkService) Job(ctx context.Context, id string) (models.Job, error) {
+	job, err := svc.jobs.get(id)
+	if err != nil {
+		return models.Job{}, err
+	}
+	if owner := readableOwner(ctx); owner != "" && job.Owner != owner {
+		return models.Job{}, fmt.Errorf("%w: %s", models.ErrJobNotFound, id)
+	}
+	return job, nil
+}
+
+func(m *jobManager) create(total int, owner string) (models.Job, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.jobs) >= m.maxJobs {
+		m.sweep(time.Now())
+		if len(m.jobs) >= m.maxJobs {
+			return models.Job{}, models.ErrTooManyJobs
+		}
+	}
+	job := &models.Job{
+		ID: newJobID(),
+		Status: models.JobRunning,
+		Total: total,
+		Results: make(map[string]models.LinkResult, total),
+		Owner: owner,
+		CreatedAt: time.Now().UTC(),
+	}
+	m.jobs[job.ID] = job
+	return copyJob(job), nil
+}
+
+func(m *jobManager) get(id string) (models.Job, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return models.Job{}, fmt.Errorf("%w: %s", models.ErrJobNotFound, id)
+	}
+	return copyJob(job), nil
+}
+
+func(m *jobManager) update(id string, apply func(job *models.Job)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if job, ok := m.jobs[id]; ok {
+		apply(job)
+	}
+}
+
+func(m *jobManager) finish(id string, res models.VerifyLinksResponse, err error) {
+	m.update(id, func(job *models.Job) {
+		job.FinishedAt = time.Now().UTC()
+		if err != nil {
+			job.Status = models.JobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = models.JobDone
+		job.Results = res.Results
+		job.Done = len(res.Results)
+		res.Results = nil
+		job.Response = &res
+	})
+}
+
+// run removes expired jobs until ctx is done.
+func(m *jobManager) run(ctx context.Context) {
+	ticker := time.NewTicker(min(m.retention, maxJobsSweepInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.mutex.Lock()
+			m.sweep(now)
+			m.mutex.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sweep removes the jobs finished more than the retention ago. The caller must hold m.mutex.
+func(m *jobManager) sweep(now time.Time) {
+	for id, job := range m.jobs {
+		if job.Finished() && now.Sub(job.FinishedAt) > m.retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func copyJob(job *models.Job) models.Job {
+	res := *job
+	res.Results = maps.Clone(job.Results)
+	return res
+}
+
+func newJobID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -1,67 +1,211 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/behummble/29-11-2025/internal/config"
 	"github.com/behummble/29-11-2025/internal/models"
-	"github.com/jung-kurt/gofpdf"
+	"github.com/behummble/29-11-2025/internal/urlnorm"
+	"github.com/behummble/29-11-2025/internal/webhook"
 )
 
+var errRevalidationStopped = errors.New("RevalidationIsNotRunning")
+
 const (
-	statusAvaliable = "avaliable"
-	statusNotAvaliable = "not avaliable"
+	defaultProbeTimeout = 10 * time.Second
+	defaultMaxLinks = 1000
+	defaultMaxRedirects = 10
 )
 
+// defaultAcceptedStatuses make every 2xx answer available.
+var defaultAcceptedStatuses = statusRanges{{from: 200, to: 299}}
+
 type LinkService struct {
 	log *slog.Logger
 	client *http.Client
 	storage Storage
+	scheduler *probeScheduler
+	// checks are the assertion rules of the probed links.
+	checks []*checkRule
+	// acceptedStatuses are the status codes of available links without a
+	// check rule of their own.
+	acceptedStatuses statusRanges
+	// method of the probes, GET or HEAD.
+	method string
+	maxRedirects int
+	noRedirects bool
+	revalidator *revalidator
+	jobs *jobManager
+	notifier *webhook.Notifier
+	// renderers of the package report by format; formats keeps their order.
+	renderers map[string]Renderer
+	formats []string
+	httpsOnly bool
+	// maxLinks caps the number of links of one verification request.
+	maxLinks int
+	// ctx is cancelled on Shutdown and interrupts background revalidation.
+	ctx context.Context
+	cancel context.CancelCauseFunc
 	shutdown chan struct{}
+	// revalidating is set while the ValidateCache loop runs.
+	revalidating atomic.Bool
 }
 
 type siteStatus struct {
 	link string
-	status string
+	result models.LinkResult
 }
 
 type Storage interface {
-	WriteLinksPackage(links []string, ) (int, error)
-	Links(packetdID int) (map[string]string, []string, error)
-	LinksStatus(links []string) map[string]string
-	ValidateCache(newValues map[string]string)
-	AllLinks() map[string]string
-	UpdateLinksInfo(links map[string]string)
+	WriteLinksPackage(links []string, owner string) (models.PackageID, error)
+	// Links returns every link of the package with its cached result, zero if
+	// there is none, and the links whose result is missing or stale.
+	Links(packetdID models.PackageID) (map[string]models.LinkResult, []string, error)
+	LinksStatus(links []string) map[string]models.LinkResult
+	ValidateCache(newValues map[string]models.LinkResult)
+	AllLinks() map[string]models.LinkResult
+	UpdateLinksInfo(links map[string]models.LinkResult)
+	PackagesWithLink(link string) []models.PackageID
+	History(link string, from, to time.Time) []models.HistoryPoint
+	Package(packageID models.PackageID) (models.LinksPackage, error)
+	Packages(filter models.PackageFilter) ([]models.LinksPackage, int)
+	DeletePackage(packageID models.PackageID) error
+	PinPackage(packageID models.PackageID, pinned bool) (models.LinksPackage, error)
 }
 
-func NewService(storage Storage, log *slog.Logger) *LinkService {
-	return &LinkService{
+// NewService fails if the probe configuration is invalid.
+func NewService(storage Storage, cfg config.Config, log *slog.Logger) (*LinkService, error) {
+	timeout := cfg.Probe.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	maxLinks := cfg.Probe.MaxLinks
+	if maxLinks <= 0 {
+		maxLinks = defaultMaxLinks
+	}
+	maxRedirects := cfg.Probe.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	accepted, err := acceptedStatuses(cfg.Probe.AcceptedStatuses)
+	if err != nil {
+		return nil, err
+	}
+	method, err := probeMethod(cfg.Probe.Method)
+	if err != nil {
+		return nil, err
+	}
+	checks, err := newCheckRules(cfg.Probe.Checks)
+	if err != nil {
+		return nil, err
+	}
+	revalidator, err := newRevalidator(cfg.Revalidation)
+	if err != nil {
+		return nil, err
+	}
+	svc := &LinkService{
 		log: log,
 		client: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout: timeout,
 		},
 		storage: storage,
+		renderers: make(map[string]Renderer),
+		httpsOnly: cfg.Probe.HTTPSOnly,
+		maxLinks: maxLinks,
+		acceptedStatuses: accepted,
+		method: method,
+		maxRedirects: maxRedirects,
+		noRedirects: cfg.Probe.NoRedirects,
+		checks: checks,
+		revalidator: revalidator,
 		shutdown: make(chan struct{}, 1),
 	}
+	svc.ctx, svc.cancel = context.WithCancelCause(context.Background())
+	svc.scheduler = newProbeScheduler(cfg.Probe, svc.probe)
+	svc.jobs = newJobManager(cfg.Jobs)
+	go svc.jobs.run(svc.ctx)
+	svc.notifier = webhook.NewNotifier(cfg.Webhooks, log)
+	svc.registerDefaultRenderers()
+	return svc, nil
+}
+
+// acceptedStatuses parses the configured status codes, the default if there
+// are none.
+func acceptedStatuses(values []string) (statusRanges, error) {
+	if len(values) == 0 {
+		return defaultAcceptedStatuses, nil
+	}
+	ranges, err := parseStatusRanges(values)
+	if err != nil {
+		return nil, fmt.Errorf("InvalidAcceptedStatuses: %w", err)
+	}
+	return ranges, nil
+}
+
+func probeMethod(method string) (string, error) {
+	switch strings.ToUpper(method) {
+	case "", http.MethodGet:
+		return http.MethodGet, nil
+	case http.MethodHead:
+		return http.MethodHead, nil
+	}
+	return "", fmt.Errorf("InvalidProbeMethod: %s", method)
 }
 
 func(svc *LinkService) Shutdown(ctx context.Context) error {
+	svc.cancel(models.ErrShuttingDown)
 	select {
 	case <- ctx.Done():
 		return context.Cause(ctx)
 	case svc.shutdown <- struct{}{}:
-		return nil
 	}
+	svc.scheduler.shutdown(shutdownResult())
+	return svc.notifier.Shutdown(ctx)
+}
+
+// Ready reports why the service cannot take requests: it is shutting down or
+// the revalidation loop is not running.
+func(svc *LinkService) Ready() error {
+	switch {
+	case svc.ctx.Err() != nil:
+		return models.ErrShuttingDown
+	case !svc.revalidating.Load():
+		return errRevalidationStopped
+	}
+	return nil
 }
 
 func(svc *LinkService) VerifyLinks(ctx context.Context, data []byte) (models.VerifyLinksResponse, error) {
+	linksRequest, err := svc.verifyRequest(data)
+	if err != nil {
+		return models.VerifyLinksResponse{}, err
+	}
+	return svc.verifyLinks(ctx, linksRequest, nil)
+}
+
+// StreamVerifyLinks is VerifyLinks that hands every result to send as soon as
+// it is known. send is called from the calling goroutine.
+func(svc *LinkService) StreamVerifyLinks(ctx context.Context, data []byte, send func(link string, result models.LinkResult)) (models.VerifyLinksResponse, error) {
+	linksRequest, err := svc.verifyRequest(data)
+	if err != nil {
+		return models.VerifyLinksResponse{}, err
+	}
+	return svc.verifyLinks(ctx, linksRequest, send)
+}
+
+func(svc *LinkService) verifyRequest(data []byte) (models.VerifyLinksRequest, error) {
+	if svc.ctx.Err() != nil {
+		return models.VerifyLinksRequest{}, models.ErrShuttingDown
+	}
 	var linksRequest models.VerifyLinksRequest
 	err := json.Unmarshal(data, &linksRequest)
 	if err != nil {
@@ -70,51 +214,97 @@ func(svc *LinkService) VerifyLinks(ctx context.Context, data []byte) (models.Ver
 			slog.String("component", "json/unmarshalling"),
 			slog.Any("error", err),
 		)
-		return models.VerifyLinksResponse{}, errors.New("DecodingDataError")
+		return models.VerifyLinksRequest{}, models.ErrDecodingData
 	}
 
 	if len(linksRequest.Links) == 0 {
-		return models.VerifyLinksResponse{}, errors.New("EmptyBody")
+		return models.VerifyLinksRequest{}, models.ErrEmptyBody
 	}
+	if len(linksRequest.Links) > svc.maxLinks {
+		return models.VerifyLinksRequest{}, fmt.Errorf("%w: %d > %d", models.ErrTooManyLinks, len(linksRequest.Links), svc.maxLinks)
+	}
+	return linksRequest, nil
+}
+
+// canonicalKeys maps every link to its canonical key and returns the unique keys in input order.
+func canonicalKeys(links []string) (map[string]string, []string) {
+	canonical := make(map[string]string, len(links))
+	keys := make([]string, 0, len(links))
+	seen := make(map[string]struct{}, len(links))
+	for _, link := range links {
+		key := urlnorm.Key(link)
+		canonical[link] = key
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	return canonical, keys
+}
 
-	cachedLinks := svc.storage.LinksStatus(linksRequest.Links)
+// verifyLinks checks the links of the request and stores them as a package.
+// progress, if set, gets every result as soon as it is known: cached ones
+// first, then the probed ones as they finish.
+func(svc *LinkService) verifyLinks(ctx context.Context, linksRequest models.VerifyLinksRequest, progress func(link string, result models.LinkResult)) (models.VerifyLinksResponse, error) {
+	canonical, keys := canonicalKeys(linksRequest.Links)
+
+	cachedLinks := svc.storage.LinksStatus(keys)
 	
-	linksInfo := make(map[string]string, len(linksRequest.Links))
-	newLinks := make(map[string]string, len(linksRequest.Links) - len(cachedLinks))
-	notInCache := make([]string, 0, len(linksInfo))
-	for _, link := range linksRequest.Links {
-		status, ok := cachedLinks[link]
-		if !ok {
-			notInCache = append(notInCache, link)
+	linksInfo := make(map[string]models.LinkResult, len(keys))
+	newLinks := make(map[string]models.LinkResult, len(keys))
+	notInCache := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result, ok := cachedLinks[key]
+		if !ok || tooOld(result, linksRequest.MaxAge) {
+			notInCache = append(notInCache, key)
 		} else {
-			linksInfo[link] = status
+			result.FromCache = true
+			linksInfo[key] = result
+			if progress != nil {
+				progress(key, result)
+			}
 		}
 	}
 
 	status := make(chan siteStatus, 10)
-	svc.linksStatus(status, notInCache)
-	
-	for siteStatus := range status {
-		linksInfo[siteStatus.link] = siteStatus.status
-		newLinks[siteStatus.link] = siteStatus.status
+	svc.linksStatus(ctx, status, notInCache, priorityAPI)
+
+	for link, result := range collectStatus(ctx, status, notInCache, progress) {
+		linksInfo[link] = result
+		if !result.Interrupted() {
+			newLinks[link] = result
+		}
 	}
 
-	id, err := svc.storage.WriteLinksPackage(linksRequest.Links)
+	id, err := svc.storage.WriteLinksPackage(keys, packageOwner(ctx))
 	if err != nil {
 		return models.VerifyLinksResponse{}, err
 	}
 
 	svc.storage.UpdateLinksInfo(newLinks)
 
+	statuses := make(map[string]string, len(canonical))
+	for link, key := range canonical {
+		statuses[link] = linksInfo[key].Status
+	}
+
 	res := models.VerifyLinksResponse{
-		Links: linksInfo,
+		Links: statuses,
 		Links_num: id,
+		Results: linksInfo,
+		Canonical: canonical,
 	}
 
 	return res, nil
 }
 
-func(svc *LinkService) PackageLinks(ctx context.Context, data []byte) ([]byte, error) {
+// PackageLinks renders the report of the packages in the format of the request
+// or, if it has none, the one negotiated from the Accept header. It returns the
+// report and its content type.
+func(svc *LinkService) PackageLinks(ctx context.Context, data []byte, accept string) ([]byte, string, error) {
+	if svc.ctx.Err() != nil {
+		return nil, "", models.ErrShuttingDown
+	}
 	var packageLinksRequest models.LinksPackageRequest
 	err := json.Unmarshal(data, &packageLinksRequest)
 	if err != nil {
@@ -123,17 +313,26 @@ func(svc *LinkService) PackageLinks(ctx context.Context, data []byte) ([]byte, e
 			slog.String("component", "json/unmarshalling"),
 			slog.Any("error", err),
 		)
-		return nil, errors.New("DecodingDataError")
+		return nil, "", models.ErrDecodingData
 	}
 
 	if len(packageLinksRequest.Links_list) == 0 {
-		return nil, errors.New("EmptyBody")
+		return nil, "", models.ErrEmptyBody
 	}
 
-	res := make(map[string]string, 1024)
-	notInCacheLinks := make(map[string]string, 1024)
+	renderer, err := svc.renderer(packageLinksRequest.Format, accept)
+	if err != nil {
+		return nil, "", err
+	}
+
+	packages := make(map[models.PackageID][]string, len(packageLinksRequest.Links_list))
+	res := make(map[string]models.LinkResult, 1024)
+	notInCacheLinks := make(map[string]models.LinkResult, 1024)
 	linksToUpdate := make([]string, 0, 1024)
 	for _, id := range packageLinksRequest.Links_list {
+		if _, err := svc.readablePackage(ctx, id); err != nil {
+			return nil, "", err
+		}
 		links, notInCache, err := svc.storage.Links(id)
 		if err != nil {
 			svc.log.Error(
@@ -141,127 +340,186 @@ func(svc *LinkService) PackageLinks(ctx context.Context, data []byte) ([]byte, e
 				slog.String("component", "storage"),
 				slog.Any("error", err),
 			)
-			return nil, err
+			return nil, "", err
 		}
-		for link, status := range links {
+		packages[id] = make([]string, 0, len(links))
+		for link, result := range links {
+			packages[id] = append(packages[id], link)
 			if _, ok := res[link]; !ok {
-				res[link] = status
+				result.FromCache = true
+				res[link] = result
 			}
 		}
 		linksToUpdate = append(linksToUpdate, notInCache...)
 	}
 
 	status := make(chan siteStatus, 10)
-	svc.linksStatus(status, linksToUpdate)
-	
-	for siteStatus := range status {
-		res[siteStatus.link] = siteStatus.status
-		notInCacheLinks[siteStatus.link] = siteStatus.status
+	svc.linksStatus(ctx, status, linksToUpdate, priorityAPI)
+
+	for link, result := range collectStatus(ctx, status, linksToUpdate, nil) {
+		res[link] = result
+		if !result.Interrupted() {
+			notInCacheLinks[link] = result
+		}
 	}
 
 	svc.storage.UpdateLinksInfo(notInCacheLinks)
 
-	return svc.createPDF(res)
+	report, err := renderer.Render(newReport(packages, res))
+	if err != nil {
+		svc.log.Error(
+			"RenderingReportError", 
+			slog.String("component", "report"),
+			slog.String("content_type", renderer.ContentType()),
+			slog.Any("error", err),
+		)
+		return nil, "", err
+	}
+	return report, renderer.ContentType(), nil
 }
 
+// ValidateCache runs the revalidation loop until Shutdown. On every tick it
+// checks the cached links that are due and stores the new results.
 func(svc *LinkService) ValidateCache() {
-	ticker := time.Tick(15 *time.Minute)
+	svc.revalidating.Store(true)
+	defer svc.revalidating.Store(false)
+	ticker := time.NewTicker(svc.revalidator.tick)
+	defer ticker.Stop()
 	loop:
 	for {
 		select {
-		case <-ticker:
-			svc.log.Info("Starting validate cache")
-			allLinks := svc.storage.AllLinks()
-			status := make(chan siteStatus, 10)
-			links := make([]string, 0, len(allLinks))
-			for key := range allLinks {
-				links = append(links, key)
-			}
-			svc.linksStatus(status, links)
-			linksToUpdate := make(map[string]string, len(allLinks)/6)
-			for siteStatus := range status {
-				if status := allLinks[siteStatus.link]; status != siteStatus.status {
-					linksToUpdate[siteStatus.link] = siteStatus.status
-				}
-			}
-			
-			svc.storage.ValidateCache(linksToUpdate)
+		case <-ticker.C:
+			svc.revalidate()
 		case <-svc.shutdown:
 			break loop
 		}
 	}
 }
 
-func linkStatus(link string, log *slog.Logger) string {
+func(svc *LinkService) revalidate() {
+	start := time.Now()
+	allLinks := svc.storage.AllLinks()
+	links := svc.revalidator.dueLinks(allLinks, time.Now())
+	if len(links) == 0 {
+		return
+	}
 
-	resp, err := http.Get(link)
-	if err != nil {
-		log.Error("Ping site error", slog.String("url", link), slog.String("error", err.Error()))
-		return statusNotAvaliable
+	svc.log.Debug("Starting validate cache", slog.Int("due", len(links)))
+	status := make(chan siteStatus, 10)
+	svc.linksStatus(svc.ctx, status, links, priorityBackground)
+	linksToUpdate := make(map[string]models.LinkResult, len(links))
+	changed := 0
+	for link, result := range collectStatus(svc.ctx, status, links, nil) {
+		if result.Interrupted() {
+			continue
+		}
+		if cached := allLinks[link]; cached.Status != result.Status {
+			changed++
+			if cached.Available() != result.Available() {
+				svc.notifyStatusChange(link, cached, result)
+			}
+		}
+		linksToUpdate[link] = result
 	}
 	
-	defer resp.Body.Close()
+	svc.storage.ValidateCache(linksToUpdate)
+	revalidationDuration.Observe(time.Since(start).Seconds())
+	svc.log.Info(
+		"Cache validated",
+		slog.Int("checked", len(linksToUpdate)),
+		slog.Int("changed", changed),
+	)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return statusNotAvaliable
+// tooOld reports whether a cached result is older than the client allows.
+func tooOld(result models.LinkResult, maxAge *int) bool {
+	if maxAge == nil {
+		return false
 	}
-	
-	return statusAvaliable
+	return time.Since(result.CheckedAt) > time.Duration(*maxAge) * time.Second
 }
 
-func(svc *LinkService) linksStatus(status chan<- siteStatus, links []string) {
+// linksStatus queues the links on the probe scheduler and sends every result
+// to status, which is closed once all links are done. It doesn't block.
+// Results are dropped once ctx is done, so the reader may stop early.
+func(svc *LinkService) linksStatus(ctx context.Context, status chan<- siteStatus, links []string, prio priority) {
 	var wg sync.WaitGroup
 	wg.Add(len(links))
-	for _, link := range links {
-
-		go func(url string) {
-			defer wg.Done()
-			resp, err := svc.client.Get(fmt.Sprintf("http://%s", link))
-			siteStatus := siteStatus{
-				link: link,
-				status: statusAvaliable,
+	go func() {
+		for _, link := range links {
+			done := func(result models.LinkResult) {
+				defer wg.Done()
+				select {
+				case status<- siteStatus{link: link, result: result}:
+				case <-ctx.Done():
+				}
 			}
-			if err != nil {
-				svc.log.Error("Ping site error", slog.String("url", link), slog.String("error", err.Error()))
-				siteStatus.status = statusNotAvaliable
-				status<- siteStatus
-				return
+			if !svc.scheduler.submit(ctx, link, prio, done) {
+				done(droppedResult(ctx))
 			}
-			
-			defer resp.Body.Close()
+		}
+		wg.Wait()
+		close(status)
+	}()
+}
 
-			if resp.StatusCode != http.StatusOK {
-				siteStatus.status = statusNotAvaliable
+// collectStatus reads status until every link is done or ctx is done. Links
+// without a result by then are reported as cancelled or timed out. progress,
+// if set, is called with every result read from status.
+func collectStatus(ctx context.Context, status <-chan siteStatus, links []string, progress func(link string, result models.LinkResult)) map[string]models.LinkResult {
+	res := make(map[string]models.LinkResult, len(links))
+	loop:
+	for {
+		select {
+		case siteStatus, ok := <-status:
+			if !ok {
+				break loop
 			}
-			status<- siteStatus
+			res[siteStatus.link] = siteStatus.result
+			if progress != nil {
+				progress(siteStatus.link, siteStatus.result)
+			}
+		case <-ctx.Done():
+			break loop
+		}
+	}
 
-		}(link)
+	for _, link := range links {
+		if _, ok := res[link]; !ok {
+			res[link] = interruptedResult(ctx)
+		}
 	}
-	
-	wg.Wait()
-	close(status)
+	return res
 }
 
-func(svc *LinkService) createPDF(links map[string]string) ([]byte, error) {
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.AddPage()
-	pdf.SetFont("Arial", "B", 12)
-	for link, status := range links {
-		pdf.Cell(0, 10, fmt.Sprintf("%s:%s", link, status))
-    	pdf.Ln(10) 
+func interruptedResult(ctx context.Context) models.LinkResult {
+	result := models.LinkResult{
+		Status: models.StatusCancelled,
+		ErrorClass: models.ErrorClassCancelled,
+		CheckedAt: time.Now().UTC(),
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.Status = models.StatusTimedOut
+		result.ErrorClass = models.ErrorClassTimeout
+	}
+	if cause := context.Cause(ctx); cause != nil {
+		result.Error = cause.Error()
 	}
+	return result
+}
 
-	buffer := bytes.NewBuffer([]byte{})
-	err := pdf.Output(buffer)
-	defer pdf.Close()
-	if err != nil {
-		svc.log.Error(
-			"CreatePDFFileError", 
-			slog.String("component", "pdf"),
-			slog.Any("error", err),
-		)
-		return nil, err
+func shutdownResult() models.LinkResult {
+	return models.LinkResult{
+		Status: models.StatusCancelled,
+		ErrorClass: models.ErrorClassCancelled,
+		Error: models.ErrShuttingDown.Error(),
+		CheckedAt: time.Now().UTC(),
 	}
+}
 
-	return buffer.Bytes(), nil
-}
\ No newline at end of file
+func droppedResult(ctx context.Context) models.LinkResult {
+	if ctx.Err() != nil {
+		return interruptedResult(ctx)
+	}
+	return shutdownResult()
+}
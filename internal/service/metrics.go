@@ -0,0 +1,45 @@
+package service
+
+import (
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/metrics"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+var (
+	probesTotal = metrics.NewCounterVec(
+		"links_probes_total",
+		"Link probes by outcome: available or the error class.",
+		"outcome",
+	)
+	probeDuration = metrics.NewHistogramVec(
+		"links_probe_duration_seconds",
+		"Latency of link probes by outcome.",
+		nil,
+		"outcome",
+	)
+	revalidationDuration = metrics.NewHistogramVec(
+		"links_revalidation_duration_seconds",
+		"Duration of the cache revalidation sweeps that had links due.",
+		[]float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	)
+)
+
+// probeOutcome is the outcome label of a probe result.
+func probeOutcome(result models.LinkResult) string {
+	switch {
+	case result.Available():
+		return "available"
+	case result.ErrorClass != "":
+		return result.ErrorClass
+	default:
+		return models.ErrorClassOther
+	}
+}
+
+func observeProbe(result models.LinkResult) {
+	outcome := probeOutcome(result)
+	probesTotal.Inc(outcome)
+	probeDuration.Observe((time.Duration(result.LatencyMS) * time.Millisecond).Seconds(), outcome)
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/behummble/29-11-2025/internal/auth"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+const (
+	defaultPackagesLimit = 50
+	maxPackagesLimit = 1000
+)
+
+// Package returns the stored package with the last known status of its
+// links. Nothing is checked: statuses may be stale, see their checked_at.
+func(svc *LinkService) Package(ctx context.Context, id models.PackageID) (models.PackageResponse, error) {
+	pkg, err := svc.readablePackage(ctx, id)
+	if err != nil {
+		return models.PackageResponse{}, err
+	}
+	cached, _, err := svc.storage.Links(id)
+	if err != nil {
+		return models.PackageResponse{}, err
+	}
+
+	results := make(map[string]models.LinkResult, len(cached))
+	for link, result := range cached {
+		if result.CheckedAt.IsZero() {
+			continue
+		}
+		result.FromCache = true
+		results[link] = result
+	}
+	return models.PackageResponse{
+		ID: pkg.ID,
+		CreatedAt: pkg.CreatedAt,
+		Pinned: pkg.Pinned,
+		Links: pkg.Links,
+		Results: results,
+	}, nil
+}
+
+func(svc *LinkService) Packages(ctx context.Context, filter models.PackageFilter) (models.PackagesPage, error) {
+	if filter.Offset < 0 || filter.Limit < 0 || filter.Limit > maxPackagesLimit {
+		return models.PackagesPage{}, models.ErrInvalidPagination
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultPackagesLimit
+	}
+	filter.Owner = readableOwner(ctx)
+
+	packages, total := svc.storage.Packages(filter)
+	page := models.PackagesPage{
+		Packages: make([]models.PackageSummary, 0, len(packages)),
+		Total: total,
+		Offset: filter.Offset,
+		Limit: filter.Limit,
+	}
+	for _, pkg := range packages {
+		page.Packages = append(page.Packages, models.PackageSummary{
+			ID: pkg.ID,
+			CreatedAt: pkg.CreatedAt,
+			Pinned: pkg.Pinned,
+			LinksNum: len(pkg.Links),
+		})
+	}
+	return page, nil
+}
+
+func(svc *LinkService) DeletePackage(ctx context.Context, id models.PackageID) error {
+	err := svc.storage.DeletePackage(id)
+	if err != nil {
+		return err
+	}
+	svc.log.Info("Package deleted", slog.String("id", string(id)))
+	return nil
+}
+
+// PinPackage exempts the package from the retention policy of the storage,
+// or releases it when pinned is false.
+func(svc *LinkService) PinPackage(ctx context.Context, id models.PackageID, pinned bool) error {
+	if _, err := svc.readablePackage(ctx, id); err != nil {
+		return err
+	}
+	if _, err := svc.storage.PinPackage(id, pinned); err != nil {
+		return err
+	}
+	svc.log.Info("Package pin changed", slog.String("id", string(id)), slog.Bool("pinned", pinned))
+	return nil
+}
+
+// readablePackage returns the package if the client of ctx may read it. The
+// packages of other clients are reported as not found.
+func(svc *LinkService) readablePackage(ctx context.Context, id models.PackageID) (models.LinksPackage, error) {
+	pkg, err := svc.storage.Package(id)
+	if err != nil {
+		return models.LinksPackage{}, err
+	}
+	if owner := readableOwner(ctx); owner != "" && pkg.Owner != owner {
+		return models.LinksPackage{}, fmt.Errorf("%w: %s", models.ErrPackageNotFound, id)
+	}
+	return pkg, nil
+}
+
+// readableOwner returns the owner of the packages the client of ctx may read,
+// or "" if it may read all of them.
+func readableOwner(ctx context.Context) string {
+	principal, ok := auth.FromContext(ctx)
+	if !ok || principal.Allowed(auth.ScopePackagesReadAll) {
+		return ""
+	}
+	return principal.ID()
+}
+
+// packageOwner returns the owner of the packages created by the client of ctx,
+// empty without authentication.
+func packageOwner(ctx context.Context) string {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return principal.ID()
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/behummble/29-11-2025/internal/models"
+	"github.com/behummble/29-11-2025/internal/urlnorm"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// gofpdf core fonts are Latin-1 only, so the report embeds a UTF-8 TTF font.
+var (
+	//go:embed fonts/DejaVuSansCondensed.ttf
+	fontRegular []byte
+	//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+	fontBold []byte
+)
+
+const (
+	pdfFont = "DejaVu"
+	pdfMargin = 15.0
+	pdfRowHeight = 6.0
+	pdfTimeLayout = "2006-01-02 15:04:05"
+)
+
+type pdfColumn struct {
+	title string
+	width float64
+	align string
+}
+
+// pdfColumns fill the 180 mm between the margins of an A4 page.
+var pdfColumns = []pdfColumn{
+	{"Link", 72, "L"},
+	{"Status", 24, "C"},
+	{"HTTP", 12, "C"},
+	{"Latency", 16, "R"},
+	{"Checked, UTC", 32, "C"},
+	{"Error", 24, "L"},
+}
+
+type pdfRenderer struct{}
+
+func(pdfRenderer) ContentType() string {
+	return "application/pdf"
+}
+
+// Render lays the report out as a title page with the summary, a table of
+// every link and a section per package. Table headers repeat on every page.
+func(pdfRenderer) Render(report models.Report) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AliasNbPages("")
+	pdf.AddUTF8FontFromBytes(pdfFont, "", fontRegular)
+	pdf.AddUTF8FontFromBytes(pdfFont, "B", fontBold)
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetTitle("Links report", true)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin + 5)
+		pdf.SetFont(pdfFont, "", 8)
+		pdf.SetTextColor(128, 128, 128)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+
+	pdfTitlePage(pdf, report)
+
+	results := make(map[string]models.LinkResult, len(report.Links))
+	links := make([]string, 0, len(report.Links))
+	for _, link := range report.Links {
+		results[link.Link] = link.Result
+		links = append(links, link.Link)
+	}
+
+	pdf.AddPage()
+	pdfHeading(pdf, "All links")
+	pdfTable(pdf, links, results)
+	for _, pkg := range report.Packages {
+		pdf.Ln(pdfRowHeight)
+		pdfHeading(pdf, fmt.Sprintf("Package %s (%d links)", pkg.ID, len(pkg.Links)))
+		pdfTable(pdf, pkg.Links, results)
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err := pdf.Output(buffer)
+	defer pdf.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func pdfTitlePage(pdf *gofpdf.Fpdf, report models.Report) {
+	pdf.AddPage()
+	pdf.Ln(40)
+	pdf.SetFont(pdfFont, "B", 24)
+	pdf.CellFormat(0, 12, "Links report", "", 1, "C", false, 0, "")
+	pdf.Ln(6)
+	pdf.SetFont(pdfFont, "", 11)
+	pdf.CellFormat(0, 7, "Generated " + report.GeneratedAt.UTC().Format(pdfTimeLayout) + " UTC", "", 1, "C", false, 0, "")
+	pdf.MultiCell(0, 7, "Packages: " + packageIDs(report.PackageIDs), "", "C", false)
+	pdf.Ln(12)
+
+	summary := []struct {
+		title string
+		count int
+		color [3]int
+	}{
+		{"Total", report.Summary.Total, [3]int{240, 240, 240}},
+		{"Available", report.Summary.Available, statusColor(models.LinkResult{Status: models.StatusAvaliable})},
+		{"Not available", report.Summary.NotAvailable, statusColor(models.LinkResult{Status: models.StatusNotAvaliable})},
+		{"Interrupted", report.Summary.Interrupted, statusColor(models.LinkResult{Status: models.StatusCancelled})},
+	}
+	left := (210 - 100) / 2.0
+	for _, row := range summary {
+		pdf.SetX(left)
+		pdf.SetFillColor(row.color[0], row.color[1], row.color[2])
+		pdf.SetFont(pdfFont, "", 11)
+		pdf.CellFormat(70, 8, row.title, "1", 0, "L", true, 0, "")
+		pdf.SetFont(pdfFont, "B", 11)
+		pdf.CellFormat(30, 8, strconv.Itoa(row.count), "1", 1, "R", true, 0, "")
+	}
+}
+
+func pdfHeading(pdf *gofpdf.Fpdf, title string) {
+	// Keep the heading on the page of the table header and first row.
+	_, pageHeight := pdf.GetPageSize()
+	if pdf.GetY() + 10 + 2 * pdfRowHeight > pageHeight - pdfMargin {
+		pdf.AddPage()
+	}
+	pdf.SetFont(pdfFont, "B", 14)
+	pdf.CellFormat(0, 10, title, "", 1, "L", false, 0, "")
+}
+
+func pdfTable(pdf *gofpdf.Fpdf, links []string, results map[string]models.LinkResult) {
+	_, pageHeight := pdf.GetPageSize()
+	pdfTableHeader(pdf)
+	pdf.SetFont(pdfFont, "", 8)
+	for _, link := range links {
+		if pdf.GetY() + pdfRowHeight > pageHeight - pdfMargin {
+			pdf.AddPage()
+			pdfTableHeader(pdf)
+			pdf.SetFont(pdfFont, "", 8)
+		}
+
+		result := results[link]
+		cells := []string{urlnorm.Display(link), result.Status, "", "", "", result.ErrorClass}
+		if result.StatusCode != 0 {
+			cells[2] = strconv.Itoa(result.StatusCode)
+		}
+		if !result.CheckedAt.IsZero() {
+			cells[3] = fmt.Sprintf("%d ms", result.LatencyMS)
+			cells[4] = result.CheckedAt.UTC().Format(pdfTimeLayout)
+		}
+		for i, column := range pdfColumns {
+			fill := i == 1
+			if fill {
+				color := statusColor(result)
+				pdf.SetFillColor(color[0], color[1], color[2])
+			}
+			pdf.CellFormat(column.width, pdfRowHeight, fitText(pdf, cells[i], column.width - 2), "1", 0, column.align, fill, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+func pdfTableHeader(pdf *gofpdf.Fpdf) {
+	pdf.SetFont(pdfFont, "B", 9)
+	pdf.SetFillColor(220, 220, 220)
+	for _, column := range pdfColumns {
+		pdf.CellFormat(column.width, pdfRowHeight + 1, column.title, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+func statusColor(result models.LinkResult) [3]int {
+	switch {
+	case result.Available():
+		return [3]int{198, 239, 206}
+	case result.Interrupted():
+		return [3]int{255, 235, 156}
+	case result.Status == "":
+		return [3]int{255, 255, 255}
+	default:
+		return [3]int{255, 199, 206}
+	}
+}
+
+// fitText shortens the text with an ellipsis so that it fits the width.
+func fitText(pdf *gofpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	n := sort.Search(len(runes), func(i int) bool {
+		return pdf.GetStringWidth(string(runes[:i + 1]) + "…") > width
+	})
+	return string(runes[:n]) + "…"
+}
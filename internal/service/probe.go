@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+var errTooManyRedirects = errors.New("TooManyRedirects")
+
+// probe checks the link over every scheme of its target until one answers.
+// An HTTP answer, even an error status, ends the probe; DNS failures do too,
+// since the other scheme would resolve the same host.
+func(svc *LinkService) probe(ctx context.Context, link string) (result models.LinkResult) {
+	defer func() { observeProbe(result) }()
+
+	target, err := parseTarget(link, svc.httpsOnly)
+	if err != nil {
+		return models.LinkResult{
+			Status: models.StatusNotAvaliable,
+			ErrorClass: models.ErrorClassInvalidURL,
+			Error: err.Error(),
+			CheckedAt: time.Now().UTC(),
+		}
+	}
+
+	rule := svc.checkRuleFor(link)
+	for _, scheme := range target.schemes {
+		result = svc.probeURL(ctx, target.url(scheme), rule)
+		result.Scheme = scheme
+		if result.StatusCode != 0 || result.Interrupted() || result.ErrorClass == models.ErrorClassDNS {
+			break
+		}
+	}
+	return result
+}
+
+// probeURL requests the URL and, if it answers with an accepted status,
+// applies the assertions of rule, if any, to the response.
+func(svc *LinkService) probeURL(ctx context.Context, url string, rule *checkRule) models.LinkResult {
+	result := models.LinkResult{
+		Status: models.StatusNotAvaliable,
+		CheckedAt: time.Now().UTC(),
+	}
+	method := svc.method
+	if rule != nil && rule.readsBody() {
+		method = http.MethodGet
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		result.ErrorClass = models.ErrorClassInvalidURL
+		result.Error = err.Error()
+		return result
+	}
+	resp, err := svc.do(request, &result)
+	if err == nil && method == http.MethodHead && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		request = request.Clone(ctx)
+		request.Method = http.MethodGet
+		resp, err = svc.do(request, &result)
+	}
+	if err != nil && ctx.Err() != nil {
+		interrupted := interruptedResult(ctx)
+		interrupted.LatencyMS = result.LatencyMS
+		return interrupted
+	}
+	if err != nil {
+		svc.log.Error("Ping site error", slog.String("url", url), slog.String("error", err.Error()))
+		result.ErrorClass = errorClass(err)
+		result.Error = err.Error()
+		if resp != nil {
+			result.StatusCode = resp.StatusCode
+			result.FinalURL = resp.Request.URL.String()
+		}
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.FinalURL = resp.Request.URL.String()
+	accepted := svc.acceptedStatuses
+	if rule != nil && rule.acceptedStatuses != nil {
+		accepted = rule.acceptedStatuses
+	}
+	if !accepted.contains(resp.StatusCode) {
+		result.ErrorClass = models.ErrorClassHTTPStatus
+		return result
+	}
+
+	if rule != nil {
+		var body []byte
+		if rule.readsBody() {
+			body, err = io.ReadAll(io.LimitReader(resp.Body, rule.bodyLimit()))
+			if err != nil && ctx.Err() != nil {
+				interrupted := interruptedResult(ctx)
+				interrupted.LatencyMS = result.LatencyMS
+				return interrupted
+			}
+			if err != nil {
+				result.ErrorClass = errorClass(err)
+				result.Error = err.Error()
+				return result
+			}
+		}
+		if failed := rule.check(resp, body, time.Duration(result.LatencyMS) * time.Millisecond); failed != nil {
+			result.ErrorClass = models.ErrorClassAssertion
+			result.FailedAssertion = failed.assertion
+			result.Error = failed.reason
+			return result
+		}
+	}
+
+	result.Status = models.StatusAvaliable
+	return result
+}
+
+// do sends the request, following redirects up to svc.maxRedirects unless
+// svc.noRedirects is set. It records the method, the redirects and the time
+// until the response headers in result.
+func(svc *LinkService) do(request *http.Request, result *models.LinkResult) (*http.Response, error) {
+	result.Method = request.Method
+	result.Redirects = nil
+	client := *svc.client
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		result.Redirects = append(result.Redirects, models.Redirect{
+			URL: via[len(via) - 1].URL.String(),
+			StatusCode: next.Response.StatusCode,
+			Location: next.URL.String(),
+		})
+		if svc.noRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > svc.maxRedirects {
+			return fmt.Errorf("%w: %d", errTooManyRedirects, svc.maxRedirects)
+		}
+		return nil
+	}
+	start := time.Now()
+	resp, err := client.Do(request)
+	result.LatencyMS = time.Since(start).Milliseconds()
+	return resp, err
+}
+
+// statusRanges are the accepted status codes of a check.
+type statusRanges []statusRange
+
+type statusRange struct {
+	from int
+	to int
+}
+
+// parseStatusRanges accepts status codes like "204" and ranges like "200-299".
+func parseStatusRanges(values []string) (statusRanges, error) {
+	ranges := make(statusRanges, 0, len(values))
+	for _, value := range values {
+		from, to, isRange := strings.Cut(strings.TrimSpace(value), "-")
+		if !isRange {
+			to = from
+		}
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("InvalidStatusRange: %s", value)
+		}
+		last, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil || first < 100 || last > 599 || first > last {
+			return nil, fmt.Errorf("InvalidStatusRange: %s", value)
+		}
+		ranges = append(ranges, statusRange{from: first, to: last})
+	}
+	return ranges, nil
+}
+
+func(r statusRanges) contains(code int) bool {
+	for _, statuses := range r {
+		if statuses.from <= code && code <= statuses.to {
+			return true
+		}
+	}
+	return false
+}
+
+func errorClass(err error) string {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCertErr x509.CertificateInvalidError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, errTooManyRedirects):
+		return models.ErrorClassTooManyRedirects
+	case errors.As(err, &dnsErr):
+		return models.ErrorClassDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return models.ErrorClassConnectionRefused
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &unknownAuthorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidCertErr):
+		return models.ErrorClassTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return models.ErrorClassTimeout
+	default:
+		return models.ErrorClassOther
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+const (
+	defaultWorkers = 64
+	defaultPerHost = 4
+	defaultQueueSize = 1024
+)
+
+type priority int
+
+const (
+	priorityAPI priority = iota
+	priorityBackground
+)
+
+type probeTask struct {
+	ctx context.Context
+	link string
+	host string
+	done func(models.LinkResult)
+}
+
+type hostState struct {
+	active int
+	pending []probeTask
+}
+
+// probeScheduler runs link probes on a fixed pool of workers. API and
+// background tasks have separate queues which workers serve in turns, and a
+// host never has more than perHost probes in flight: extra tasks for a busy
+// host are parked until one of its probes finishes, so they don't hold a worker.
+type probeScheduler struct {
+	api chan probeTask
+	background chan probeTask
+	probe func(ctx context.Context, link string) models.LinkResult
+	perHost int
+	hosts map[string]*hostState
+	mutex sync.Mutex
+	stop chan struct{}
+	stopOnce sync.Once
+	// submitting is held by submits while they queue a task and by shutdown
+	// while it drains the queues, so no task is queued after the drain.
+	submitting sync.RWMutex
+	wg sync.WaitGroup
+}
+
+func newProbeScheduler(cfg config.ProbeConfig, probe func(ctx context.Context, link string) models.LinkResult) *probeScheduler {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.PerHost <= 0 {
+		cfg.PerHost = defaultPerHost
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+
+	scheduler := &probeScheduler{
+		api: make(chan probeTask, cfg.QueueSize),
+		background: make(chan probeTask, cfg.QueueSize),
+		probe: probe,
+		perHost: cfg.PerHost,
+		hosts: make(map[string]*hostState),
+		stop: make(chan struct{}),
+	}
+	scheduler.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go scheduler.work(i % 2 == 0)
+	}
+	return scheduler
+}
+
+// submit queues the link and blocks while the queue is full. It returns false
+// if the scheduler was stopped or ctx was done before the task could be queued.
+func(s *probeScheduler) submit(ctx context.Context, link string, prio priority, done func(models.LinkResult)) bool {
+	queue := s.api
+	if prio == priorityBackground {
+		queue = s.background
+	}
+	task := probeTask{
+		ctx: ctx,
+		link: link,
+		host: linkHost(link),
+		done: done,
+	}
+	s.submitting.RLock()
+	defer s.submitting.RUnlock()
+	select {
+	case <-s.stop:
+		return false
+	default:
+	}
+	select {
+	case queue <- task:
+		return true
+	case <-s.stop:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// shutdown stops the workers and completes every task that was still waiting
+// in a queue or parked on a busy host with the given result.
+func(s *probeScheduler) shutdown(dropped models.LinkResult) {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.wg.Wait()
+
+	// Submits blocked on a full queue return on stop, the later ones see it.
+	s.submitting.Lock()
+	defer s.submitting.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for host, state := range s.hosts {
+		for _, task := range state.pending {
+			task.done(dropped)
+		}
+		delete(s.hosts, host)
+	}
+	for {
+		select {
+		case task := <-s.api:
+			task.done(dropped)
+		case task := <-s.background:
+			task.done(dropped)
+		default:
+			return
+		}
+	}
+}
+
+func(s *probeScheduler) work(preferAPI bool) {
+	defer s.wg.Done()
+	for {
+		task, ok := s.next(preferAPI)
+		if !ok {
+			return
+		}
+		preferAPI = !preferAPI
+		if !s.acquire(task) {
+			continue
+		}
+		for next := &task; next != nil; next = s.release(next.host) {
+			s.run(*next)
+		}
+	}
+}
+
+// run skips the probe if nobody waits for its result anymore.
+func(s *probeScheduler) run(task probeTask) {
+	if task.ctx.Err() != nil {
+		task.done(interruptedResult(task.ctx))
+		return
+	}
+	task.done(s.probe(task.ctx, task.link))
+}
+
+func(s *probeScheduler) next(preferAPI bool) (probeTask, bool) {
+	first, second := s.api, s.background
+	if !preferAPI {
+		first, second = second, first
+	}
+	select {
+	case task := <-first:
+		return task, true
+	default:
+	}
+	select {
+	case task := <-first:
+		return task, true
+	case task := <-second:
+		return task, true
+	case <-s.stop:
+		return probeTask{}, false
+	}
+}
+
+// acquire takes a slot of the task host or parks the task if the host is busy.
+func(s *probeScheduler) acquire(task probeTask) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.hosts[task.host]
+	if !ok {
+		state = &hostState{}
+		s.hosts[task.host] = state
+	}
+	if state.active < s.perHost {
+		state.active++
+		return true
+	}
+	state.pending = append(state.pending, task)
+	return false
+}
+
+// release hands the slot to the next parked task of the host, if any.
+func(s *probeScheduler) release(host string) *probeTask {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := s.hosts[host]
+	if len(state.pending) > 0 {
+		task := state.pending[0]
+		state.pending = state.pending[1:]
+		return &task
+	}
+	state.active--
+	if state.active == 0 {
+		delete(s.hosts, host)
+	}
+	return nil
+}
+
+func linkHost(link string) string {
+	if target, err := parseTarget(link, true); err == nil {
+		return target.host
+	}
+	host, _, _ := strings.Cut(link, "/")
+	return strings.ToLower(host)
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+type csvRenderer struct{}
+
+func(csvRenderer) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+// Render writes one row per link and package; a link in several packages has several rows.
+func(csvRenderer) Render(report models.Report) ([]byte, error) {
+	results := make(map[string]models.LinkResult, len(report.Links))
+	for _, link := range report.Links {
+		results[link.Link] = link.Result
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	writer := csv.NewWriter(buffer)
+	writer.Write([]string{
+		"package_id", "link", "status", "status_code", "final_url", "scheme",
+		"latency_ms", "error_class", "error", "checked_at", "from_cache",
+	})
+	for _, pkg := range report.Packages {
+		for _, link := range pkg.Links {
+			result := results[link]
+			writer.Write([]string{
+				string(pkg.ID),
+				csvCell(link),
+				result.Status,
+				strconv.Itoa(result.StatusCode),
+				csvCell(result.FinalURL),
+				result.Scheme,
+				strconv.FormatInt(result.LatencyMS, 10),
+				result.ErrorClass,
+				csvCell(result.Error),
+				result.CheckedAt.Format(time.RFC3339),
+				strconv.FormatBool(result.FromCache),
+			})
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+type jsonRenderer struct{}
+
+func(jsonRenderer) ContentType() string {
+	return "application/json"
+}
+
+func(jsonRenderer) Render(report models.Report) ([]byte, error) {
+	return json.Marshal(report)
+}
+
+type markdownRenderer struct{}
+
+func(markdownRenderer) ContentType() string {
+	return "text/markdown; charset=utf-8"
+}
+
+func(markdownRenderer) Render(report models.Report) ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buffer, "# Links report\n\n")
+	fmt.Fprintf(buffer, "Generated %s for packages %s.\n\n", report.GeneratedAt.Format(time.RFC3339), packageIDs(report.PackageIDs))
+	fmt.Fprintf(
+		buffer,
+		"Total: %d, available: %d, not available: %d, interrupted: %d.\n\n",
+		report.Summary.Total, report.Summary.Available, report.Summary.NotAvailable, report.Summary.Interrupted,
+	)
+	fmt.Fprintf(buffer, "| Link | Status | HTTP | Latency, ms | Checked | Error |\n")
+	fmt.Fprintf(buffer, "| --- | --- | --- | --- | --- | --- |\n")
+	for _, link := range report.Links {
+		result := link.Result
+		statusCode := ""
+		if result.StatusCode != 0 {
+			statusCode = strconv.Itoa(result.StatusCode)
+		}
+		fmt.Fprintf(
+			buffer,
+			"| %s | %s | %s | %d | %s | %s |\n",
+			markdownCell(link.Link),
+			markdownCell(result.Status),
+			statusCode,
+			result.LatencyMS,
+			result.CheckedAt.Format(time.RFC3339),
+			markdownCell(result.ErrorClass),
+		)
+	}
+	return buffer.Bytes(), nil
+}
+
+// csvCell keeps spreadsheets from running a value as a formula by prefixing
+// the values starting like one with a quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func markdownCell(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+	return strings.ReplaceAll(value, "\n", " ")
+}
+
+type htmlRenderer struct{}
+
+func(htmlRenderer) ContentType() string {
+	return "text/html; charset=utf-8"
+}
+
+func(htmlRenderer) Render(report models.Report) ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	err := htmlReport.Execute(buffer, report)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// htmlReport is self-contained: the styles are inline and nothing is loaded.
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+	"ids": packageIDs,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Links report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+.up { color: #1a7f37; }
+.down { color: #cf222e; }
+.interrupted { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>Links report</h1>
+<p>Generated {{time .GeneratedAt}} for packages {{ids .PackageIDs}}.</p>
+<p>Total: {{.Summary.Total}}, available: {{.Summary.Available}}, not available: {{.Summary.NotAvailable}}, interrupted: {{.Summary.Interrupted}}.</p>
+<table>
+<tr><th>Link</th><th>Status</th><th>HTTP</th><th>Latency, ms</th><th>Checked</th><th>Error</th></tr>
+{{range .Links}}<tr>
+<td>{{.Link}}</td>
+<td class="{{if .Result.Available}}up{{else if .Result.Interrupted}}interrupted{{else}}down{{end}}">{{.Result.Status}}</td>
+<td>{{if .Result.StatusCode}}{{.Result.StatusCode}}{{end}}</td>
+<td>{{.Result.LatencyMS}}</td>
+<td>{{time .Result.CheckedAt}}</td>
+<td>{{.Result.ErrorClass}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func packageIDs(ids []models.PackageID) string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, string(id))
+	}
+	return strings.Join(res, ", ")
+}
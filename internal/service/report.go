@@ -0,0 +1,141 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+const (
+	FormatPDF = "pdf"
+	FormatCSV = "csv"
+	FormatJSON = "json"
+	FormatHTML = "html"
+	FormatMarkdown = "markdown"
+)
+
+// Renderer turns a package report into one output format.
+type Renderer interface {
+	ContentType() string
+	Render(report models.Report) ([]byte, error)
+}
+
+// RegisterRenderer adds or replaces the renderer of a format. Formats are
+// negotiated in registration order, so the first one is the default.
+func(svc *LinkService) RegisterRenderer(format string, renderer Renderer) {
+	if _, ok := svc.renderers[format]; !ok {
+		svc.formats = append(svc.formats, format)
+	}
+	svc.renderers[format] = renderer
+}
+
+func(svc *LinkService) registerDefaultRenderers() {
+	svc.RegisterRenderer(FormatPDF, pdfRenderer{})
+	svc.RegisterRenderer(FormatCSV, csvRenderer{})
+	svc.RegisterRenderer(FormatJSON, jsonRenderer{})
+	svc.RegisterRenderer(FormatHTML, htmlRenderer{})
+	svc.RegisterRenderer(FormatMarkdown, markdownRenderer{})
+}
+
+// renderer picks the renderer of the format if it is set, or the best match
+// of the Accept header otherwise.
+func(svc *LinkService) renderer(format, accept string) (Renderer, error) {
+	if format != "" {
+		renderer, ok := svc.renderers[strings.ToLower(format)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", models.ErrUnsupportedFormat, format)
+		}
+		return renderer, nil
+	}
+	if strings.TrimSpace(accept) == "" {
+		return svc.renderers[svc.formats[0]], nil
+	}
+
+	for _, mediaRange := range parseAccept(accept) {
+		for _, format := range svc.formats {
+			renderer := svc.renderers[format]
+			if mediaTypeMatches(mediaRange, renderer.ContentType()) {
+				return renderer, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", models.ErrUnsupportedFormat, accept)
+}
+
+// parseAccept returns the media ranges of the Accept header, most preferred
+// first. Ranges with q=0 are left out.
+func parseAccept(accept string) []string {
+	type mediaRange struct {
+		value string
+		q float64
+	}
+	ranges := make([]mediaRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{value: mediaType, q: q})
+		}
+	}
+	slices.SortStableFunc(ranges, func(a, b mediaRange) int {
+		return cmp.Compare(b.q, a.q)
+	})
+
+	res := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		res = append(res, r.value)
+	}
+	return res
+}
+
+func mediaTypeMatches(mediaRange, contentType string) bool {
+	contentType, _, _ = mime.ParseMediaType(contentType)
+	if mediaRange == "*/*" || mediaRange == contentType {
+		return true
+	}
+	rangeType, subtype, _ := strings.Cut(mediaRange, "/")
+	contentMainType, _, _ := strings.Cut(contentType, "/")
+	return subtype == "*" && rangeType == contentMainType
+}
+
+// newReport builds the report of the packages from the results of their links.
+func newReport(packages map[models.PackageID][]string, results map[string]models.LinkResult) models.Report {
+	report := models.Report{
+		GeneratedAt: time.Now().UTC(),
+		PackageIDs: make([]models.PackageID, 0, len(packages)),
+		Links: make([]models.ReportLink, 0, len(results)),
+		Packages: make([]models.ReportPackage, 0, len(packages)),
+	}
+	for id := range packages {
+		report.PackageIDs = append(report.PackageIDs, id)
+	}
+	slices.SortFunc(report.PackageIDs, models.ComparePackageIDs)
+	for _, id := range report.PackageIDs {
+		links := slices.Clone(packages[id])
+		slices.Sort(links)
+		report.Packages = append(report.Packages, models.ReportPackage{ID: id, Links: links})
+	}
+
+	for link, result := range results {
+		report.Links = append(report.Links, models.ReportLink{Link: link, Result: result})
+	}
+	report.Summary = models.Summarize(results)
+	slices.SortFunc(report.Links, func(a, b models.ReportLink) int {
+		return strings.Compare(a.Link, b.Link)
+	})
+	return report
+}
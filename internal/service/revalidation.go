@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+const (
+	defaultRevalidationInterval = 15 * time.Minute
+	defaultRevalidationTick = 10 * time.Second
+	// catchUpFactor lets a tick check more than its fair share of links, so
+	// links that became due at the same time are drained over a few ticks.
+	catchUpFactor = 1.5
+	// minTickBudget keeps small caches from being throttled at all.
+	minTickBudget = 10
+)
+
+// revalidator decides which cached links are due for a new check. A link is
+// due once its interval has passed since the last check, shifted by a jitter
+// that is stable per link, and every tick takes only its share of the links.
+type revalidator struct {
+	interval time.Duration
+	jitter time.Duration
+	tick time.Duration
+	rules []revalidationRule
+}
+
+type revalidationRule struct {
+	pattern *regexp.Regexp
+	interval time.Duration
+}
+
+type dueLink struct {
+	link string
+	dueAt time.Time
+}
+
+// newRevalidator fails on the first invalid rule.
+func newRevalidator(cfg config.RevalidationConfig) (*revalidator, error) {
+	r := &revalidator{
+		interval: cfg.Interval,
+		jitter: cfg.Jitter,
+		tick: cfg.Tick,
+	}
+	if r.interval <= 0 {
+		r.interval = defaultRevalidationInterval
+	}
+	if r.tick <= 0 {
+		r.tick = defaultRevalidationTick
+	}
+	if r.jitter < 0 {
+		r.jitter = 0
+	}
+
+	for _, rule := range cfg.Rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("InvalidRevalidationRule: %s: %w", rule.Pattern, err)
+		}
+		if rule.Interval <= 0 {
+			return nil, fmt.Errorf("InvalidRevalidationRule: %s: %w", rule.Pattern, errors.New("NonPositiveInterval"))
+		}
+		r.rules = append(r.rules, revalidationRule{pattern: pattern, interval: rule.Interval})
+	}
+	return r, nil
+}
+
+// intervalFor returns the interval of the first rule matching the link.
+func(r *revalidator) intervalFor(link string) time.Duration {
+	for _, rule := range r.rules {
+		if rule.pattern.MatchString(link) {
+			return rule.interval
+		}
+	}
+	return r.interval
+}
+
+// offset maps the link to a point in [-jitter, jitter].
+func(r *revalidator) offset(link string) time.Duration {
+	if r.jitter == 0 {
+		return 0
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(link))
+	return time.Duration(hash.Sum64() % uint64(2 * r.jitter + 1)) - r.jitter
+}
+
+// dueLinks returns the links to check on this tick, the most overdue first.
+func(r *revalidator) dueLinks(links map[string]models.LinkResult, now time.Time) []string {
+	due := make([]dueLink, 0)
+	share := 0.0
+	for link, result := range links {
+		interval := r.intervalFor(link)
+		share += float64(r.tick) / float64(interval)
+		dueAt := result.CheckedAt.Add(interval + r.offset(link))
+		if !dueAt.After(now) {
+			due = append(due, dueLink{link: link, dueAt: dueAt})
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].dueAt.Before(due[j].dueAt)
+	})
+	budget := max(int(math.Ceil(share * catchUpFactor)), minTickBudget)
+	if len(due) > budget {
+		due = due[:budget]
+	}
+
+	res := make([]string, 0, len(due))
+	for _, d := range due {
+		res = append(res, d.link)
+	}
+	return res
+}
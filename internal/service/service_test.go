@@ -1,58 +1,88 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	"errors"
 
+	"github.com/behummble/29-11-2025/internal/auth"
+	"github.com/behummble/29-11-2025/internal/config"
 	"github.com/behummble/29-11-2025/internal/models"
 )
 
 type mockStorage struct {
-	links    map[int][]string
-	cache    map[string]string
+	links    map[models.PackageID][]string
+	cache    map[string]models.LinkResult
+	history  map[string][]models.HistoryPoint
+	owners   map[models.PackageID]string
+	pinned   map[models.PackageID]bool
+	expired  map[models.PackageID]bool
 	lastID   int
 }
 
 func newMockStorage() *mockStorage {
 	return &mockStorage{
-		links: make(map[int][]string),
-		cache:    make(map[string]string),
+		links: make(map[models.PackageID][]string),
+		cache:    make(map[string]models.LinkResult),
+		history:  make(map[string][]models.HistoryPoint),
+		owners:   make(map[models.PackageID]string),
+		pinned:   make(map[models.PackageID]bool),
+		expired:  make(map[models.PackageID]bool),
 		lastID:   0,
 	}
 }
 
-func (m *mockStorage) WriteLinksPackage(links []string) (int, error) {
+func newTestService(t *testing.T, storage Storage, cfg config.Config, log *slog.Logger) *LinkService {
+	t.Helper()
+	service, err := NewService(storage, cfg, log)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	return service
+}
+
+func (m *mockStorage) WriteLinksPackage(links []string, owner string) (models.PackageID, error) {
 	m.lastID++
-	m.links[m.lastID] = links
-	return m.lastID, nil
+	id := models.NumericPackageID(m.lastID)
+	m.links[id] = links
+	m.owners[id] = owner
+	return id, nil
 }
 
-func (m *mockStorage) Links(packageID int) (map[string]string, []string, error) {
+func (m *mockStorage) Links(packageID models.PackageID) (map[string]models.LinkResult, []string, error) {
 	links, exists := m.links[packageID]
 	if !exists {
 		return nil, nil, errors.New("PackageNotFound")
 	}
 	
-	result := make(map[string]string)
+	result := make(map[string]models.LinkResult)
 	notCached := []string{}
 	
 	for _, link := range links {
-		if status, exists := m.cache[link]; exists {
-			result[link] = status
-		} else {
+		status, exists := m.cache[link]
+		if !exists {
 			notCached = append(notCached, link)
 		}
+		result[link] = status
 	}
 	
 	return result, notCached, nil
 }
 
-func (m *mockStorage) LinksStatus(links []string) map[string]string {
-	result := make(map[string]string)
+func (m *mockStorage) LinksStatus(links []string) map[string]models.LinkResult {
+	result := make(map[string]models.LinkResult)
 	for _, link := range links {
 		if status, exists := m.cache[link]; exists {
 			result[link] = status
@@ -61,19 +91,84 @@ func (m *mockStorage) LinksStatus(links []string) map[string]string {
 	return result
 }
 
-func (m *mockStorage) ValidateCache(newValues map[string]string) {
+func (m *mockStorage) ValidateCache(newValues map[string]models.LinkResult) {
 	// Not needed for basic tests
 }
 
-func (m *mockStorage) AllLinks() map[string]string {
-	result := make(map[string]string)
+func (m *mockStorage) AllLinks() map[string]models.LinkResult {
+	result := make(map[string]models.LinkResult)
 	for k, v := range m.cache {
 		result[k] = v
 	}
 	return result
 }
 
-func (m *mockStorage) UpdateLinksInfo(links map[string]string) {
+func (m *mockStorage) PackagesWithLink(link string) []models.PackageID {
+	result := []models.PackageID{}
+	for id, links := range m.links {
+		for _, l := range links {
+			if l == link {
+				result = append(result, id)
+			}
+		}
+	}
+	return result
+}
+
+func (m *mockStorage) History(link string, from, to time.Time) []models.HistoryPoint {
+	result := []models.HistoryPoint{}
+	for _, point := range m.history[link] {
+		if !point.Time.Before(from) && point.Time.Before(to) {
+			result = append(result, point)
+		}
+	}
+	return result
+}
+
+func (m *mockStorage) Package(packageID models.PackageID) (models.LinksPackage, error) {
+	links, exists := m.links[packageID]
+	if m.expired[packageID] {
+		return models.LinksPackage{}, fmt.Errorf("%w: %s", models.ErrPackageExpired, packageID)
+	}
+	if !exists {
+		return models.LinksPackage{}, fmt.Errorf("%w: %s", models.ErrPackageNotFound, packageID)
+	}
+	return models.LinksPackage{ID: packageID, Links: links, Owner: m.owners[packageID], Pinned: m.pinned[packageID]}, nil
+}
+
+func (m *mockStorage) PinPackage(packageID models.PackageID, pinned bool) (models.LinksPackage, error) {
+	if _, err := m.Package(packageID); err != nil {
+		return models.LinksPackage{}, err
+	}
+	m.pinned[packageID] = pinned
+	return m.Package(packageID)
+}
+
+func (m *mockStorage) Packages(filter models.PackageFilter) ([]models.LinksPackage, int) {
+	result := []models.LinksPackage{}
+	for n := 1; n <= m.lastID; n++ {
+		id := models.NumericPackageID(n)
+		if links, exists := m.links[id]; exists && (filter.Owner == "" || filter.Owner == m.owners[id]) {
+			result = append(result, models.LinksPackage{ID: id, Links: links, Owner: m.owners[id]})
+		}
+	}
+	total := len(result)
+	result = result[min(filter.Offset, total):]
+	if filter.Limit < len(result) {
+		result = result[:filter.Limit]
+	}
+	return result, total
+}
+
+func (m *mockStorage) DeletePackage(packageID models.PackageID) error {
+	if _, exists := m.links[packageID]; !exists {
+		return fmt.Errorf("%w: %s", models.ErrPackageNotFound, packageID)
+	}
+	delete(m.links, packageID)
+	return nil
+}
+
+func (m *mockStorage) UpdateLinksInfo(links map[string]models.LinkResult) {
 	for k, v := range links {
 		m.cache[k] = v
 	}
@@ -81,7 +176,7 @@ func (m *mockStorage) UpdateLinksInfo(links map[string]string) {
 
 func TestLinkService_VerifyLinks(t *testing.T) {
 	mockStorage := newMockStorage()
-	service := NewService(mockStorage, slog.Default())
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
 	
 	links := []string{"example.com", "google.com"}
 	request := models.VerifyLinksRequest{Links: links}
@@ -96,18 +191,329 @@ func TestLinkService_VerifyLinks(t *testing.T) {
 		t.Fatalf("VerifyLinks failed: %v", err)
 	}
 	
-	if response.Links_num != 1 {
-		t.Errorf("Expected Links_num 1, got %d", response.Links_num)
+	if response.Links_num != "1" {
+		t.Errorf("Expected Links_num 1, got %s", response.Links_num)
 	}
 	
 	if len(response.Links) != 2 {
 		t.Errorf("Expected 2 links in response, got %d", len(response.Links))
 	}
+
+	for link, result := range response.Results {
+		if result.Status != response.Links[link] {
+			t.Errorf("Expected derived status '%s' for %s, got '%s'", result.Status, link, response.Links[link])
+		}
+		if result.CheckedAt.IsZero() {
+			t.Errorf("Expected check time for %s", link)
+		}
+	}
+}
+
+func TestLinkService_ProbeResult(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	host := strings.TrimPrefix(target.URL, "http://")
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedHost := strings.TrimPrefix(closed.URL, "http://")
+	closed.Close()
+	defer target.Close()
+
+	service := newTestService(t, newMockStorage(), config.Config{}, slog.Default())
+
+	result := service.probe(context.Background(), host + "/moved")
+	if !result.Available() || result.StatusCode != http.StatusOK {
+		t.Errorf("Expected available with status 200, got %+v", result)
+	}
+	if result.FinalURL != target.URL + "/ok" {
+		t.Errorf("Expected final URL %s/ok, got %s", target.URL, result.FinalURL)
+	}
+	if result.Scheme != "http" {
+		t.Errorf("Expected HTTPS to fall back to http, got scheme '%s'", result.Scheme)
+	}
+
+	result = service.probe(context.Background(), host + "/missing")
+	if result.Available() || result.ErrorClass != models.ErrorClassHTTPStatus || result.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected http_status error with status 404, got %+v", result)
+	}
+
+	result = service.probe(context.Background(), closedHost)
+	if result.Available() || result.ErrorClass != models.ErrorClassConnectionRefused {
+		t.Errorf("Expected connection_refused error, got %+v", result)
+	}
+}
+
+func TestNewService_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg config.Config
+	}{
+		{"accepted statuses", config.Config{Probe: config.ProbeConfig{AcceptedStatuses: []string{"200-"}}}},
+		{"method", config.Config{Probe: config.ProbeConfig{Method: "POST"}}},
+		{"check pattern", config.Config{Probe: config.ProbeConfig{Checks: []config.CheckRule{{Pattern: "("}}}}},
+		{"check statuses", config.Config{Probe: config.ProbeConfig{Checks: []config.CheckRule{{Pattern: "/api$", AcceptedStatuses: []string{"2xx", "abc"}}}}}},
+		{"check JSON path", config.Config{Probe: config.ProbeConfig{Checks: []config.CheckRule{{Pattern: "/api$", JSON: []config.JSONAssertion{{Path: "$.items[x]"}}}}}}},
+		{"revalidation pattern", config.Config{Revalidation: config.RevalidationConfig{Rules: []config.RevalidationRule{{Pattern: "(", Interval: time.Minute}}}}},
+		{"revalidation interval", config.Config{Revalidation: config.RevalidationConfig{Rules: []config.RevalidationRule{{Pattern: "^api\\.", Interval: 0}}}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewService(newMockStorage(), tt.cfg, slog.Default()); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestLinkService_ProbeAssertions(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/maintenance":
+			w.Write([]byte("<h1>Down for maintenance</h1>"))
+		case "/api":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status": "ok", "items": [{"id": 7}]}`))
+		case "/degraded":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status": "degraded", "items": []}`))
+		case "/slow":
+			time.Sleep(50 * time.Millisecond)
+		default:
+			w.Write([]byte(strings.Repeat("Welcome ", 100)))
+		}
+	}))
+	defer target.Close()
+	host := strings.TrimPrefix(target.URL, "http://")
+
+	cfg := config.Config{Probe: config.ProbeConfig{Checks: []config.CheckRule{
+		{Pattern: "/maintenance$", BodyContains: []string{"Welcome"}},
+		{Pattern: "/(api|degraded)$", Headers: map[string]string{"content-type": "application/json"},
+			JSON: []config.JSONAssertion{{Path: "$.status", Equals: "ok"}, {Path: "$.items[0].id", Equals: 7}}},
+		{Pattern: "/missing$", Headers: map[string]string{"X-Version": ""}},
+		{Pattern: "/slow$", MaxLatency: 10 * time.Millisecond},
+		{Pattern: "/large$", BodyNotContains: []string{"Sorry"}, MaxBodySize: 100},
+		{Pattern: "/home$", BodyMatches: "^(Welcome )+$"},
+	}}}
+	service := newTestService(t, newMockStorage(), cfg, slog.Default())
+
+	tests := []struct {
+		path string
+		assertion string
+		reason string
+	}{
+		{"/maintenance", models.AssertionBodyContains, `body does not contain "Welcome"`},
+		{"/api", "", ""},
+		{"/degraded", models.AssertionJSONPath, `$.status is "degraded", not "ok"`},
+		{"/missing", models.AssertionHeader, "header X-Version is missing"},
+		{"/slow", models.AssertionMaxLatency, ""},
+		{"/large", models.AssertionMaxBodySize, "body exceeds 100 bytes"},
+		{"/home", "", ""},
+	}
+	for _, tt := range tests {
+		result := service.probe(context.Background(), host + tt.path)
+		if tt.assertion == "" {
+			if !result.Available() {
+				t.Errorf("%s: expected available, got %+v", tt.path, result)
+			}
+			continue
+		}
+		if result.Available() || result.ErrorClass != models.ErrorClassAssertion || result.FailedAssertion != tt.assertion {
+			t.Errorf("%s: expected failed assertion %s, got %+v", tt.path, tt.assertion, result)
+		}
+		if tt.reason != "" && result.Error != tt.reason {
+			t.Errorf("%s: expected error '%s', got '%s'", tt.path, tt.reason, result.Error)
+		}
+		if result.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected the status code to be kept, got %d", tt.path, result.StatusCode)
+		}
+	}
+}
+
+func TestLinkService_ProbeCriteria(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/protected":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/account":
+			http.Redirect(w, r, "/login", http.StatusMovedPermanently)
+		case "/login":
+			w.Write([]byte("Sign in"))
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/get-only":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		}
+	}))
+	defer target.Close()
+	host := strings.TrimPrefix(target.URL, "http://")
+
+	service := newTestService(t, newMockStorage(), config.Config{Probe: config.ProbeConfig{
+		Method: "head",
+		MaxRedirects: 2,
+		Checks: []config.CheckRule{{Pattern: "/protected$", AcceptedStatuses: []string{"200-299", "401"}}},
+	}}, slog.Default())
+
+	result := service.probe(context.Background(), host + "/empty")
+	if !result.Available() || result.Method != http.MethodHead {
+		t.Errorf("Expected 204 to be available over HEAD, got %+v", result)
+	}
+	result = service.probe(context.Background(), host + "/get-only")
+	if !result.Available() || result.Method != http.MethodGet {
+		t.Errorf("Expected a fallback to GET after 405, got %+v", result)
+	}
+	result = service.probe(context.Background(), host + "/protected")
+	if !result.Available() || result.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 to be accepted by the rule, got %+v", result)
+	}
+
+	result = service.probe(context.Background(), host + "/account")
+	expected := []models.Redirect{{URL: target.URL + "/account", StatusCode: http.StatusMovedPermanently, Location: target.URL + "/login"}}
+	if !result.Available() || !slices.Equal(result.Redirects, expected) {
+		t.Errorf("Expected the redirect chain %+v, got %+v", expected, result)
+	}
+	result = service.probe(context.Background(), host + "/loop")
+	if result.Available() || result.ErrorClass != models.ErrorClassTooManyRedirects || result.StatusCode != http.StatusFound || len(result.Redirects) != 3 {
+		t.Errorf("Expected too_many_redirects after 2 redirects, got %+v", result)
+	}
+
+	service = newTestService(t, newMockStorage(), config.Config{Probe: config.ProbeConfig{
+		NoRedirects: true,
+		AcceptedStatuses: []string{"200-299", "301"},
+	}}, slog.Default())
+	result = service.probe(context.Background(), host + "/account")
+	if !result.Available() || result.StatusCode != http.StatusMovedPermanently || result.FinalURL != target.URL + "/account" || !slices.Equal(result.Redirects, expected) {
+		t.Errorf("Expected the redirect itself to be the accepted result, got %+v", result)
+	}
+	result = service.probe(context.Background(), host + "/protected")
+	if result.Available() || result.ErrorClass != models.ErrorClassHTTPStatus {
+		t.Errorf("Expected 401 to be rejected, got %+v", result)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		link string
+		httpsOnly bool
+		urls []string
+		host string
+	}{
+		{"example.com", false, []string{"https://example.com", "http://example.com"}, "example.com"},
+		{"example.com", true, []string{"https://example.com"}, "example.com"},
+		{"https://Example.com/path?q=1", false, []string{"https://Example.com/path?q=1"}, "example.com"},
+		{"HTTP://example.com:8080/a", true, []string{"http://example.com:8080/a"}, "example.com:8080"},
+		{"localhost:8090/success", false, []string{"https://localhost:8090/success", "http://localhost:8090/success"}, "localhost:8090"},
+	}
+	for _, test := range tests {
+		target, err := parseTarget(test.link, test.httpsOnly)
+		if err != nil {
+			t.Errorf("parseTarget(%q) failed: %v", test.link, err)
+			continue
+		}
+		urls := make([]string, 0, len(target.schemes))
+		for _, scheme := range target.schemes {
+			urls = append(urls, target.url(scheme))
+		}
+		if strings.Join(urls, " ") != strings.Join(test.urls, " ") {
+			t.Errorf("parseTarget(%q): expected %v, got %v", test.link, test.urls, urls)
+		}
+		if target.host != test.host {
+			t.Errorf("parseTarget(%q): expected host %s, got %s", test.link, test.host, target.host)
+		}
+	}
+
+	for _, link := range []string{"", "ftp://example.com", "https://", "/path"} {
+		if _, err := parseTarget(link, false); err == nil {
+			t.Errorf("Expected parseTarget(%q) to fail", link)
+		}
+	}
+}
+
+func TestLinkService_VerifyLinks_Canonical(t *testing.T) {
+	mockStorage := newMockStorage()
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
+	mockStorage.UpdateLinksInfo(map[string]models.LinkResult{
+		"example.com": {Status: models.StatusAvaliable},
+	})
+
+	links := []string{"Example.com/", "example.com", "http://example.com#top"}
+	data, err := json.Marshal(models.VerifyLinksRequest{Links: links})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	response, err := service.VerifyLinks(context.Background(), data)
+	if err != nil {
+		t.Fatalf("VerifyLinks failed: %v", err)
+	}
+
+	if len(response.Results) != 1 {
+		t.Errorf("Expected 1 canonical result, got %d", len(response.Results))
+	}
+	for _, link := range links {
+		if response.Canonical[link] != "example.com" {
+			t.Errorf("Expected %s to map to 'example.com', got '%s'", link, response.Canonical[link])
+		}
+		if response.Links[link] != models.StatusAvaliable {
+			t.Errorf("Expected cached status for %s, got '%s'", link, response.Links[link])
+		}
+	}
+	if stored := mockStorage.links[response.Links_num]; len(stored) != 1 {
+		t.Errorf("Expected deduplicated package, got %v", stored)
+	}
+}
+
+func TestLinkService_VerifyLinks_MaxAge(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+	host := strings.TrimPrefix(target.URL, "http://")
+
+	mockStorage := newMockStorage()
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
+	mockStorage.UpdateLinksInfo(map[string]models.LinkResult{
+		host: {Status: models.StatusNotAvaliable, CheckedAt: time.Now().Add(-time.Hour)},
+	})
+
+	verify := func(maxAge *int) models.LinkResult {
+		data, err := json.Marshal(models.VerifyLinksRequest{Links: []string{host}, MaxAge: maxAge})
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		response, err := service.VerifyLinks(context.Background(), data)
+		if err != nil {
+			t.Fatalf("VerifyLinks failed: %v", err)
+		}
+		return response.Results[host]
+	}
+
+	result := verify(nil)
+	if !result.FromCache || result.Status != models.StatusNotAvaliable {
+		t.Errorf("Expected cached result, got %+v", result)
+	}
+
+	maxAge := 60
+	result = verify(&maxAge)
+	if result.FromCache || result.Status != models.StatusAvaliable {
+		t.Errorf("Expected fresh result, got %+v", result)
+	}
+	if time.Since(result.CheckedAt) > time.Minute {
+		t.Errorf("Expected recent check time, got %s", result.CheckedAt)
+	}
 }
 
 func TestLinkService_VerifyLinks_EmptyBody(t *testing.T) {
 	mockStorage := newMockStorage()
-	service := NewService(mockStorage, slog.Default())
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
 	
 	ctx := context.Background()
 	request := models.VerifyLinksRequest{}
@@ -128,33 +534,49 @@ func TestLinkService_VerifyLinks_EmptyBody(t *testing.T) {
 
 func TestLinkService_VerifyLinks_InvalidJSON(t *testing.T) {
 	mockStorage := newMockStorage()
-	service := NewService(mockStorage, slog.Default())
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
 	
 	ctx := context.Background()
 	_, err := service.VerifyLinks(ctx, []byte("{invalid json"))
 	
-	if err == nil {
-		t.Error("Expected error for invalid JSON")
+	if !errors.Is(err, models.ErrDecodingData) {
+		t.Errorf("Expected %v for invalid JSON, got %v", models.ErrDecodingData, err)
+	}
+}
+
+func TestLinkService_VerifyLinks_TooManyLinks(t *testing.T) {
+	service := newTestService(t, newMockStorage(), config.Config{Probe: config.ProbeConfig{MaxLinks: 2}}, slog.Default())
+
+	data, _ := json.Marshal(models.VerifyLinksRequest{Links: []string{"a.example", "b.example", "c.example"}})
+	_, err := service.VerifyLinks(context.Background(), data)
+	if !errors.Is(err, models.ErrTooManyLinks) {
+		t.Errorf("Expected %v, got %v", models.ErrTooManyLinks, err)
+	}
+
+	service.cancel(models.ErrShuttingDown)
+	data, _ = json.Marshal(models.VerifyLinksRequest{Links: []string{"a.example"}})
+	if _, err = service.VerifyLinks(context.Background(), data); !errors.Is(err, models.ErrShuttingDown) {
+		t.Errorf("Expected %v after shutdown, got %v", models.ErrShuttingDown, err)
 	}
 }
 
 func TestLinkService_PackageLinks(t *testing.T) {
 	mockStorage := newMockStorage()
-	service := NewService(mockStorage, slog.Default())
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
 	
-	packageID, err := mockStorage.WriteLinksPackage([]string{"example.com"})
+	packageID, err := mockStorage.WriteLinksPackage([]string{"example.com"}, "")
 	if err != nil {
 		t.Fatalf("WriteLinksPackage failed: %v", err)
 	}
 	
-	request := models.LinksPackageRequest{Links_list: []int{packageID}}
+	request := models.LinksPackageRequest{Links_list: []models.PackageID{packageID}}
 	data, err := json.Marshal(request)
 	if err != nil {
 		t.Fatalf("Marshal failed: %v", err)
 	}
 	
 	ctx := context.Background()
-	response, err := service.PackageLinks(ctx, data)
+	response, contentType, err := service.PackageLinks(ctx, data, "")
 	if err != nil {
 		t.Fatalf("PackageLinks failed: %v", err)
 	}
@@ -162,19 +584,642 @@ func TestLinkService_PackageLinks(t *testing.T) {
 	if len(response) == 0 {
 		t.Error("Expected non-empty response")
 	}
+	if contentType != "application/pdf" {
+		t.Errorf("Expected PDF by default, got %s", contentType)
+	}
+}
+
+func TestLinkService_PackageLinks_Expired(t *testing.T) {
+	mockStorage := newMockStorage()
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
+	mockStorage.lastID = 2
+	mockStorage.expired["1"] = true
+
+	for id, expected := range map[models.PackageID]error{"1": models.ErrPackageExpired, "7": models.ErrPackageNotFound} {
+		data, _ := json.Marshal(models.LinksPackageRequest{Links_list: []models.PackageID{id}})
+		if _, _, err := service.PackageLinks(context.Background(), data, ""); !errors.Is(err, expected) {
+			t.Errorf("Expected %v for package %s, got %v", expected, id, err)
+		}
+	}
+
+	id, _ := mockStorage.WriteLinksPackage([]string{"example.com"}, "")
+	if err := service.PinPackage(context.Background(), id, true); err != nil {
+		t.Fatalf("PinPackage failed: %v", err)
+	}
+	if pkg, _ := service.Package(context.Background(), id); !pkg.Pinned {
+		t.Error("Expected the package to be pinned")
+	}
+}
+
+func TestLinkService_PackageLinks_Formats(t *testing.T) {
+	mockStorage := newMockStorage()
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
+	defer service.Shutdown(context.Background())
+
+	mockStorage.WriteLinksPackage([]string{"b.example.com", "a|b.example.com"}, "")
+	mockStorage.UpdateLinksInfo(map[string]models.LinkResult{
+		"b.example.com": {Status: models.StatusAvaliable, StatusCode: 200, CheckedAt: time.Now()},
+		"a|b.example.com": {Status: models.StatusNotAvaliable, ErrorClass: models.ErrorClassDNS, CheckedAt: time.Now()},
+	})
+	data, _ := json.Marshal(models.LinksPackageRequest{Links_list: []models.PackageID{"1"}})
+
+	tests := []struct {
+		accept string
+		contentType string
+		contains string
+	}{
+		{"text/csv", "text/csv; charset=utf-8", "1,b.example.com,avaliable,200"},
+		{"application/json", "application/json", `"available":1`},
+		{"text/html", "text/html; charset=utf-8", `<td class="down">not avaliable</td>`},
+		{"text/markdown", "text/markdown; charset=utf-8", `| a\|b.example.com | not avaliable |`},
+		{"text/*;q=0.5, application/json", "application/json", `"package_ids":[1]`},
+		{"*/*", "application/pdf", "%PDF"},
+	}
+	for _, tt := range tests {
+		report, contentType, err := service.PackageLinks(context.Background(), data, tt.accept)
+		if err != nil {
+			t.Fatalf("PackageLinks(%q) failed: %v", tt.accept, err)
+		}
+		if contentType != tt.contentType {
+			t.Errorf("PackageLinks(%q): expected %s, got %s", tt.accept, tt.contentType, contentType)
+		}
+		if !strings.Contains(string(report), tt.contains) {
+			t.Errorf("PackageLinks(%q): expected %q in\n%s", tt.accept, tt.contains, report)
+		}
+	}
+
+	if _, _, err := service.PackageLinks(context.Background(), data, "image/png"); !errors.Is(err, models.ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+	data, _ = json.Marshal(models.LinksPackageRequest{Links_list: []models.PackageID{"1"}, Format: "csv"})
+	if _, contentType, _ := service.PackageLinks(context.Background(), data, "application/json"); contentType != "text/csv; charset=utf-8" {
+		t.Errorf("Expected the format field to win over Accept, got %s", contentType)
+	}
 }
 
 func TestLinkService_Shutdown(t *testing.T) {
 	mockStorage := newMockStorage()
-	service := NewService(mockStorage, slog.Default())
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if err := service.Ready(); !errors.Is(err, errRevalidationStopped) {
+		t.Errorf("Expected %v before ValidateCache, got %v", errRevalidationStopped, err)
+	}
 	go service.ValidateCache()
 	time.Sleep(5 * time.Second)
+	if err := service.Ready(); err != nil {
+		t.Errorf("Expected the service to be ready, got %v", err)
+	}
 	err := service.Shutdown(ctx)
 	if err != nil {
 		t.Errorf("Shutdown failed: %v", err)
 	}
-}
\ No newline at end of file
+	if err := service.Ready(); !errors.Is(err, models.ErrShuttingDown) {
+		t.Errorf("Expected %v after Shutdown, got %v", models.ErrShuttingDown, err)
+	}
+}
+func TestProbeScheduler_ConcurrencyLimits(t *testing.T) {
+	var mutex sync.Mutex
+	active, maxActive := 0, 0
+	activeHosts := make(map[string]int)
+	maxPerHost := 0
+
+	probe := func(ctx context.Context, link string) models.LinkResult {
+		host := linkHost(link)
+		mutex.Lock()
+		active++
+		activeHosts[host]++
+		maxActive = max(maxActive, active)
+		maxPerHost = max(maxPerHost, activeHosts[host])
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		active--
+		activeHosts[host]--
+		mutex.Unlock()
+		return models.LinkResult{Status: models.StatusAvaliable}
+	}
+
+	scheduler := newProbeScheduler(config.ProbeConfig{Workers: 8, PerHost: 2, QueueSize: 4}, probe)
+	defer scheduler.shutdown(models.LinkResult{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		link := fmt.Sprintf("host%d.com/page%d", i % 3, i)
+		prio := priorityAPI
+		if i % 2 == 0 {
+			prio = priorityBackground
+		}
+		wg.Add(1)
+		go scheduler.submit(context.Background(), link, prio, func(models.LinkResult) { wg.Done() })
+	}
+	wg.Wait()
+
+	if maxActive > 8 {
+		t.Errorf("Expected at most 8 probes in flight, got %d", maxActive)
+	}
+	if maxPerHost > 2 {
+		t.Errorf("Expected at most 2 probes per host, got %d", maxPerHost)
+	}
+}
+
+func TestProbeScheduler_ShutdownCompletesQueued(t *testing.T) {
+	probe := func(ctx context.Context, link string) models.LinkResult {
+		time.Sleep(time.Millisecond)
+		return models.LinkResult{Status: models.StatusAvaliable}
+	}
+	scheduler := newProbeScheduler(config.ProbeConfig{Workers: 2, PerHost: 1, QueueSize: 4}, probe)
+
+	var queued, done atomic.Int64
+	var submitters sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		submitters.Add(1)
+		go func() {
+			defer submitters.Done()
+			for j := 0; ; j++ {
+				link := fmt.Sprintf("host%d-%d.com", i, j)
+				if !scheduler.submit(context.Background(), link, priorityBackground, func(models.LinkResult) { done.Add(1) }) {
+					return
+				}
+				queued.Add(1)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	scheduler.shutdown(models.LinkResult{})
+	submitters.Wait()
+
+	if queued.Load() != done.Load() {
+		t.Errorf("Expected every queued task to be completed, %d queued and %d done", queued.Load(), done.Load())
+	}
+}
+
+func TestLinkService_VerifyLinks_ManyLinks(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+	host := strings.TrimPrefix(target.URL, "http://")
+
+	service := newTestService(t, newMockStorage(), config.Config{Probe: config.ProbeConfig{Workers: 4, PerHost: 2}}, slog.Default())
+	links := make([]string, 50)
+	for i := range links {
+		links[i] = fmt.Sprintf("%s/%d", host, i)
+	}
+	data, err := json.Marshal(models.VerifyLinksRequest{Links: links})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	response, err := service.VerifyLinks(context.Background(), data)
+	if err != nil {
+		t.Fatalf("VerifyLinks failed: %v", err)
+	}
+	if len(response.Links) != len(links) {
+		t.Errorf("Expected %d links in response, got %d", len(links), len(response.Links))
+	}
+}
+
+func TestLinkService_VerifyLinks_Deadline(t *testing.T) {
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer target.Close()
+	defer close(release)
+	host := strings.TrimPrefix(target.URL, "http://")
+
+	mockStorage := newMockStorage()
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
+	data, err := json.Marshal(models.VerifyLinksRequest{Links: []string{host + "/slow"}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	response, err := service.VerifyLinks(ctx, data)
+	if err != nil {
+		t.Fatalf("VerifyLinks failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2 * time.Second {
+		t.Errorf("Expected VerifyLinks to return after the deadline, took %s", elapsed)
+	}
+	if status := response.Links[host + "/slow"]; status != models.StatusTimedOut {
+		t.Errorf("Expected '%s', got '%s'", models.StatusTimedOut, status)
+	}
+	if _, ok := mockStorage.cache[host + "/slow"]; ok {
+		t.Error("Expected interrupted result not to be cached")
+	}
+}
+
+func TestRevalidator_DueLinks(t *testing.T) {
+	cfg := config.RevalidationConfig{
+		Interval: time.Hour,
+		Tick: 10 * time.Second,
+		Rules: []config.RevalidationRule{
+			{Pattern: `^critical\.`, Interval: 30 * time.Second},
+		},
+	}
+	revalidator, err := newRevalidator(cfg)
+	if err != nil {
+		t.Fatalf("newRevalidator failed: %v", err)
+	}
+
+	now := time.Now()
+	links := map[string]models.LinkResult{
+		"critical.example.com": {CheckedAt: now.Add(-time.Minute)},
+		"example.com": {CheckedAt: now.Add(-time.Minute)},
+		"old.example.com": {CheckedAt: now.Add(-2 * time.Hour)},
+	}
+	due := revalidator.dueLinks(links, now)
+	if len(due) != 2 || due[0] != "old.example.com" || due[1] != "critical.example.com" {
+		t.Errorf("Expected [old.example.com critical.example.com], got %v", due)
+	}
+
+	many := make(map[string]models.LinkResult, 3600)
+	for i := 0; i < 3600; i++ {
+		many[fmt.Sprintf("site%d.com", i)] = models.LinkResult{CheckedAt: now.Add(-2 * time.Hour)}
+	}
+	// 3600 links checked hourly make 10 links per 10s tick, plus the catch-up share.
+	if due := revalidator.dueLinks(many, now); len(due) < 15 || len(due) > 16 {
+		t.Errorf("Expected the tick budget to limit due links to about 15, got %d", len(due))
+	}
+}
+
+func TestRevalidator_Jitter(t *testing.T) {
+	revalidator, _ := newRevalidator(config.RevalidationConfig{Jitter: time.Minute})
+	for i := 0; i < 100; i++ {
+		link := fmt.Sprintf("site%d.com", i)
+		offset := revalidator.offset(link)
+		if offset < -time.Minute || offset > time.Minute {
+			t.Errorf("Expected offset within jitter, got %s", offset)
+		}
+		if offset != revalidator.offset(link) {
+			t.Errorf("Expected offset of %s to be stable", link)
+		}
+	}
+}
+
+func TestLinkService_Revalidate_StatusChangeWebhook(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer target.Close()
+	host := strings.TrimPrefix(target.URL, "http://")
+
+	events := make(chan models.StatusChangeEvent, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event models.StatusChangeEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+		events <- event
+	}))
+	defer receiver.Close()
+
+	mockStorage := newMockStorage()
+	cfg := config.Config{
+		Webhooks: config.WebhooksConfig{
+			Endpoints: []config.WebhookEndpoint{{URL: receiver.URL, Secret: "secret"}},
+		},
+	}
+	service := newTestService(t, mockStorage, cfg, slog.Default())
+	id, _ := mockStorage.WriteLinksPackage([]string{host}, "")
+	mockStorage.UpdateLinksInfo(map[string]models.LinkResult{
+		host: {Status: models.StatusAvaliable, CheckedAt: time.Now().Add(-time.Hour)},
+	})
+
+	service.revalidate()
+
+	select {
+	case event := <-events:
+		if event.Type != models.EventLinkDown || event.Link != host {
+			t.Errorf("Expected %s event for %s, got %+v", models.EventLinkDown, host, event)
+		}
+		if event.OldStatus != models.StatusAvaliable || event.NewStatus != models.StatusNotAvaliable {
+			t.Errorf("Expected avaliable -> not avaliable, got %s -> %s", event.OldStatus, event.NewStatus)
+		}
+		if len(event.Packages) != 1 || event.Packages[0] != id {
+			t.Errorf("Expected packages [%s], got %v", id, event.Packages)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a status change webhook")
+	}
+}
+
+func TestLinkService_LinkUptime(t *testing.T) {
+	mockStorage := newMockStorage()
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
+
+	start := time.Date(2025, 11, 29, 0, 0, 0, 0, time.UTC)
+	mockStorage.history["example.com"] = []models.HistoryPoint{
+		{Time: start, Checks: 1, Up: 1, LatencyMS: 100},
+		{Time: start.Add(time.Minute), Checks: 1, Up: 0, LatencyMS: 900},
+		{Time: start.Add(2 * time.Minute), Checks: 1, Up: 0, LatencyMS: 1000},
+		{Time: start.Add(3 * time.Minute), Checks: 1, Up: 1, LatencyMS: 200},
+		// A downsampled hour with one failed check out of six.
+		{Time: start.Add(time.Hour), Checks: 6, Up: 5, LatencyMS: 300},
+	}
+
+	report, err := service.LinkUptime(context.Background(), "https://Example.com/", start, start.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatalf("LinkUptime failed: %v", err)
+	}
+	if report.Link != "example.com" || report.Checks != 10 {
+		t.Errorf("Expected 10 checks of example.com, got %d of %s", report.Checks, report.Link)
+	}
+	if report.UptimePercent != 70 {
+		t.Errorf("Expected 70%% uptime, got %v", report.UptimePercent)
+	}
+	if report.Incidents != 2 {
+		t.Errorf("Expected 2 incidents, got %d", report.Incidents)
+	}
+	if report.LatencyP50MS != 300 || report.LatencyP90MS != 900 || report.LatencyP99MS != 1000 {
+		t.Errorf("Expected p50/p90/p99 300/900/1000, got %d/%d/%d", report.LatencyP50MS, report.LatencyP90MS, report.LatencyP99MS)
+	}
+
+	if _, err := service.LinkUptime(context.Background(), "example.com", start, start); err == nil {
+		t.Error("Expected error for empty time window")
+	}
+}
+
+func TestLinkService_Packages(t *testing.T) {
+	mockStorage := newMockStorage()
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
+	defer service.Shutdown(context.Background())
+
+	mockStorage.WriteLinksPackage([]string{"example.com", "google.com"}, "")
+	mockStorage.WriteLinksPackage([]string{"github.com"}, "")
+	mockStorage.UpdateLinksInfo(map[string]models.LinkResult{
+		"example.com": {Status: models.StatusAvaliable, CheckedAt: time.Now()},
+	})
+
+	pkg, err := service.Package(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("Package failed: %v", err)
+	}
+	if len(pkg.Links) != 2 {
+		t.Errorf("Expected 2 links, got %d", len(pkg.Links))
+	}
+	if len(pkg.Results) != 1 || !pkg.Results["example.com"].FromCache {
+		t.Errorf("Expected only example.com to have a cached result, got %v", pkg.Results)
+	}
+
+	page, err := service.Packages(context.Background(), models.PackageFilter{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("Packages failed: %v", err)
+	}
+	if page.Total != 2 || len(page.Packages) != 1 || page.Packages[0].ID != "2" || page.Packages[0].LinksNum != 1 {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+	if _, err := service.Packages(context.Background(), models.PackageFilter{Limit: -1}); err == nil {
+		t.Error("Expected error for negative limit")
+	}
+
+	if err := service.DeletePackage(context.Background(), "1"); err != nil {
+		t.Fatalf("DeletePackage failed: %v", err)
+	}
+	if _, err := service.Package(context.Background(), "1"); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected ErrPackageNotFound, got %v", err)
+	}
+}
+
+func TestLinkService_PackageOwners(t *testing.T) {
+	mockStorage := newMockStorage()
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
+	defer service.Shutdown(context.Background())
+
+	teamA := auth.WithPrincipal(context.Background(), auth.Principal{Name: "team-a", Source: auth.SourceAPIKey, Scopes: []string{auth.ScopePackagesRead}})
+	teamB := auth.WithPrincipal(context.Background(), auth.Principal{Name: "team-b", Source: auth.SourceAPIKey, Scopes: []string{auth.ScopePackagesRead}})
+	tokenA := auth.WithPrincipal(context.Background(), auth.Principal{Name: "team-a", Source: auth.SourceJWT, Scopes: []string{auth.ScopePackagesRead}})
+	auditor := auth.WithPrincipal(context.Background(), auth.Principal{Name: "audit", Source: auth.SourceAPIKey, Scopes: []string{auth.ScopePackagesReadAll}})
+
+	data, _ := json.Marshal(models.VerifyLinksRequest{Links: []string{"example.invalid"}})
+	res, err := service.VerifyLinks(teamA, data)
+	if err != nil {
+		t.Fatalf("VerifyLinks failed: %v", err)
+	}
+	if mockStorage.owners[res.Links_num] != "key:team-a" {
+		t.Errorf("Expected the package to belong to key:team-a, got '%s'", mockStorage.owners[res.Links_num])
+	}
+
+	if _, err := service.Package(teamA, res.Links_num); err != nil {
+		t.Errorf("Expected the owner to read the package, got %v", err)
+	}
+	if _, err := service.Package(teamB, res.Links_num); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected %v for another client, got %v", models.ErrPackageNotFound, err)
+	}
+	if _, err := service.Package(tokenA, res.Links_num); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected %v for a JWT subject named like the API key, got %v", models.ErrPackageNotFound, err)
+	}
+	if _, err := service.Package(auditor, res.Links_num); err != nil {
+		t.Errorf("Expected packages:read:all to read the package, got %v", err)
+	}
+	report, _ := json.Marshal(models.LinksPackageRequest{Links_list: []models.PackageID{res.Links_num}, Format: FormatJSON})
+	if _, _, err := service.PackageLinks(teamB, report, ""); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected %v for the report of another client, got %v", models.ErrPackageNotFound, err)
+	}
+	if page, _ := service.Packages(teamB, models.PackageFilter{}); page.Total != 0 {
+		t.Errorf("Expected no packages of team-b, got %+v", page)
+	}
+}
+
+func TestPDFRenderer_Layout(t *testing.T) {
+	report := models.Report{
+		GeneratedAt: time.Now(),
+		PackageIDs: []models.PackageID{"1", "2"},
+		Packages: []models.ReportPackage{
+			{ID: "1", Links: []string{"xn--e1afmkfd.xn--p1ai"}},
+			{ID: "2", Links: []string{}},
+		},
+	}
+	report.Links = append(report.Links, models.ReportLink{
+		Link: "xn--e1afmkfd.xn--p1ai",
+		Result: models.LinkResult{Status: models.StatusAvaliable, StatusCode: 200, CheckedAt: time.Now()},
+	})
+	for i := 0; i < 150; i++ {
+		link := fmt.Sprintf("example%03d.com/%s", i, strings.Repeat("very-long-path/", 10))
+		report.Links = append(report.Links, models.ReportLink{
+			Link: link,
+			Result: models.LinkResult{Status: models.StatusNotAvaliable, ErrorClass: models.ErrorClassDNS, CheckedAt: time.Now()},
+		})
+		report.Packages[1].Links = append(report.Packages[1].Links, link)
+	}
+
+	data, err := pdfRenderer{}.Render(report)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "%PDF") {
+		t.Fatal("Expected a PDF document")
+	}
+	// Title page, at least 4 pages of the 151 rows table and 4 more for package 2.
+	if pages := strings.Count(string(data), "/Type /Page\n"); pages < 9 {
+		t.Errorf("Expected the tables to break across pages, got %d pages", pages)
+	}
+	if !strings.Contains(string(data), "/FontFile2") {
+		t.Error("Expected the UTF-8 font to be embedded")
+	}
+}
+
+func TestCSVRenderer_Formulas(t *testing.T) {
+	report := models.Report{
+		Packages: []models.ReportPackage{
+			{ID: "1", Links: []string{`=HYPERLINK("http://evil.example","x")`, "example.com"}},
+		},
+		Links: []models.ReportLink{
+			{Link: `=HYPERLINK("http://evil.example","x")`, Result: models.LinkResult{Status: models.StatusNotAvaliable, Error: "@SUM(1+1)"}},
+			{Link: "example.com", Result: models.LinkResult{Status: models.StatusAvaliable, FinalURL: "+cmd"}},
+		},
+	}
+	data, err := csvRenderer{}.Render(report)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %v", records)
+	}
+	if records[1][1] != `'=HYPERLINK("http://evil.example","x")` || records[1][8] != "'@SUM(1+1)" {
+		t.Errorf("Expected the formulas to be quoted, got %v", records[1])
+	}
+	if records[2][1] != "example.com" || records[2][4] != "'+cmd" {
+		t.Errorf("Expected only the values starting like a formula to be quoted, got %v", records[2])
+	}
+}
+
+func TestLinkService_SubmitVerifyJob(t *testing.T) {
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/slow") {
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+	host := strings.TrimPrefix(target.URL, "http://")
+
+	mockStorage := newMockStorage()
+	service := newTestService(t, mockStorage, config.Config{}, slog.Default())
+	defer service.Shutdown(context.Background())
+	mockStorage.UpdateLinksInfo(map[string]models.LinkResult{
+		host + "/cached": {Status: models.StatusAvaliable, CheckedAt: time.Now()},
+	})
+
+	data, _ := json.Marshal(models.VerifyLinksRequest{Links: []string{host + "/cached", host + "/fast", host + "/slow"}})
+	job, err := service.SubmitVerifyJob(context.Background(), data)
+	if err != nil {
+		t.Fatalf("SubmitVerifyJob failed: %v", err)
+	}
+	if job.Status != models.JobRunning || job.Total != 3 {
+		t.Errorf("Expected a running job of 3 links, got %+v", job)
+	}
+
+	poll := func(done func(models.Job) bool) models.Job {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			job, err := service.Job(context.Background(), job.ID)
+			if err != nil {
+				t.Fatalf("Job failed: %v", err)
+			}
+			if done(job) {
+				return job
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("Timed out polling the job")
+		return models.Job{}
+	}
+
+	partial := poll(func(job models.Job) bool { return job.Done == 2 })
+	if partial.Finished() || !partial.Results[host + "/cached"].FromCache {
+		t.Errorf("Expected a running job with the cached result, got %+v", partial)
+	}
+
+	close(release)
+	finished := poll(models.Job.Finished)
+	if finished.Status != models.JobDone || finished.Done != 3 || finished.Response == nil || finished.Response.Links_num == "" {
+		t.Errorf("Expected a done job with a package, got %+v", finished)
+	}
+
+	if _, err := service.Job(context.Background(), "unknown"); !errors.Is(err, models.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+
+	teamA := auth.WithPrincipal(context.Background(), auth.Principal{Name: "team-a", Source: auth.SourceAPIKey, Scopes: []string{auth.ScopeVerify}})
+	teamB := auth.WithPrincipal(context.Background(), auth.Principal{Name: "team-b", Source: auth.SourceAPIKey, Scopes: []string{auth.ScopeVerify}})
+	job, err = service.SubmitVerifyJob(teamA, data)
+	if err != nil {
+		t.Fatalf("SubmitVerifyJob failed: %v", err)
+	}
+	if _, err := service.Job(teamA, job.ID); err != nil {
+		t.Errorf("Expected the owner to read the job, got %v", err)
+	}
+	if _, err := service.Job(teamB, job.ID); !errors.Is(err, models.ErrJobNotFound) {
+		t.Errorf("Expected %v for another client, got %v", models.ErrJobNotFound, err)
+	}
+}
+
+func TestJobManager_Retention(t *testing.T) {
+	jobs := newJobManager(config.JobsConfig{Retention: time.Minute, MaxJobs: 2})
+
+	first, _ := jobs.create(1, "")
+	jobs.create(1, "")
+	if _, err := jobs.create(1, ""); !errors.Is(err, models.ErrTooManyJobs) {
+		t.Errorf("Expected ErrTooManyJobs, got %v", err)
+	}
+
+	jobs.finish(first.ID, models.VerifyLinksResponse{}, nil)
+	jobs.update(first.ID, func(job *models.Job) {
+		job.FinishedAt = time.Now().Add(-2 * time.Minute)
+	})
+	if _, err := jobs.create(1, ""); err != nil {
+		t.Errorf("Expected the expired job to make room, got %v", err)
+	}
+	if _, err := jobs.get(first.ID); !errors.Is(err, models.ErrJobNotFound) {
+		t.Errorf("Expected the expired job to be removed, got %v", err)
+	}
+}
+
+func TestLinkService_StreamVerifyLinks(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+	host := strings.TrimPrefix(target.URL, "http://")
+
+	service := newTestService(t, newMockStorage(), config.Config{}, slog.Default())
+	defer service.Shutdown(context.Background())
+
+	data, _ := json.Marshal(models.VerifyLinksRequest{Links: []string{host + "/a", host + "/b", "http://" + host + "/a"}})
+	sent := make(map[string]models.LinkResult)
+	response, err := service.StreamVerifyLinks(context.Background(), data, func(link string, result models.LinkResult) {
+		if _, ok := sent[link]; ok {
+			t.Errorf("Result of %s sent twice", link)
+		}
+		sent[link] = result
+	})
+	if err != nil {
+		t.Fatalf("StreamVerifyLinks failed: %v", err)
+	}
+	if len(sent) != 2 || len(response.Results) != 2 {
+		t.Errorf("Expected 2 unique results to be sent, got %v", sent)
+	}
+	for link, result := range sent {
+		if response.Results[link].Status != result.Status {
+			t.Errorf("Sent result of %s differs from the response", link)
+		}
+	}
+}
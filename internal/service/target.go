@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+const (
+	schemeHTTP = "http"
+	schemeHTTPS = "https"
+)
+
+// target is a link prepared for probing: the schemes to try in order and
+// the scheme-less rest of the URL.
+type target struct {
+	schemes []string
+	host string
+	rest string
+}
+
+// parseTarget accepts full URLs, bare hosts and hosts with ports and paths.
+// Links without a scheme are tried over HTTPS first and, unless httpsOnly is
+// set, over plain HTTP if HTTPS doesn't answer.
+func parseTarget(link string, httpsOnly bool) (target, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return target{}, errors.New("EmptyLink")
+	}
+
+	schemes := []string{schemeHTTPS}
+	if !httpsOnly {
+		schemes = append(schemes, schemeHTTP)
+	}
+	raw := link
+	if scheme, rest, ok := strings.Cut(link, "://"); ok {
+		scheme = strings.ToLower(scheme)
+		if scheme != schemeHTTP && scheme != schemeHTTPS {
+			return target{}, errors.New("UnsupportedScheme: " + scheme)
+		}
+		schemes = []string{scheme}
+		raw = rest
+	}
+
+	parsed, err := url.Parse(schemeHTTPS + "://" + raw)
+	if err != nil {
+		return target{}, err
+	}
+	if parsed.Hostname() == "" {
+		return target{}, errors.New("EmptyHost")
+	}
+
+	return target{
+		schemes: schemes,
+		host: strings.ToLower(parsed.Host),
+		rest: raw,
+	}, nil
+}
+
+func(t target) url(scheme string) string {
+	return scheme + "://" + t.rest
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/models"
+	"github.com/behummble/29-11-2025/internal/urlnorm"
+)
+
+func(svc *LinkService) LinkHistory(ctx context.Context, link string, from, to time.Time) ([]models.HistoryPoint, error) {
+	key, err := historyKey(link, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return svc.storage.History(key, from, to), nil
+}
+
+// LinkUptime summarizes the link history between from and to.
+func(svc *LinkService) LinkUptime(ctx context.Context, link string, from, to time.Time) (models.UptimeReport, error) {
+	key, err := historyKey(link, from, to)
+	if err != nil {
+		return models.UptimeReport{}, err
+	}
+	report := uptimeReport(svc.storage.History(key, from, to))
+	report.Link = key
+	report.From = from
+	report.To = to
+	return report, nil
+}
+
+func historyKey(link string, from, to time.Time) (string, error) {
+	if link == "" {
+		return "", models.ErrEmptyLink
+	}
+	if !from.Before(to) {
+		return "", models.ErrInvalidTimeWindow
+	}
+	return urlnorm.Key(link), nil
+}
+
+func uptimeReport(points []models.HistoryPoint) models.UptimeReport {
+	var report models.UptimeReport
+	up := 0
+	down := false
+	for _, point := range points {
+		report.Checks += point.Checks
+		up += point.Up
+		if point.Down() && !down {
+			report.Incidents++
+		}
+		down = point.Down()
+	}
+	if report.Checks > 0 {
+		report.UptimePercent = float64(up) * 100 / float64(report.Checks)
+	}
+
+	report.LatencyP50MS = latencyPercentile(points, 50)
+	report.LatencyP90MS = latencyPercentile(points, 90)
+	report.LatencyP99MS = latencyPercentile(points, 99)
+	return report
+}
+
+// latencyPercentile is the nearest-rank percentile of the latencies, each
+// point weighted by its number of checks.
+func latencyPercentile(points []models.HistoryPoint, percentile int) int64 {
+	sorted := slices.Clone(points)
+	slices.SortFunc(sorted, func(a, b models.HistoryPoint) int {
+		return cmp.Compare(a.LatencyMS, b.LatencyMS)
+	})
+	total := 0
+	for _, point := range sorted {
+		total += point.Checks
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := (total * percentile + 99) / 100
+	seen := 0
+	for _, point := range sorted {
+		seen += point.Checks
+		if seen >= rank {
+			return point.LatencyMS
+		}
+	}
+	return sorted[len(sorted) - 1].LatencyMS
+}
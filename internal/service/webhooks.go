@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+func(svc *LinkService) RegisterWebhook(ctx context.Context, data []byte) (models.Webhook, error) {
+	var hook models.Webhook
+	err := json.Unmarshal(data, &hook)
+	if err != nil {
+		svc.log.Error(
+			"ParsingJSONError", 
+			slog.String("component", "json/unmarshalling"),
+			slog.Any("error", err),
+		)
+		return models.Webhook{}, models.ErrDecodingData
+	}
+	return svc.notifier.Register(hook)
+}
+
+func(svc *LinkService) Webhooks(ctx context.Context) []models.Webhook {
+	return svc.notifier.Webhooks()
+}
+
+func(svc *LinkService) DeleteWebhook(ctx context.Context, id string) error {
+	return svc.notifier.Delete(id)
+}
+
+func(svc *LinkService) WebhookDeliveries(ctx context.Context, limit int) []models.WebhookDelivery {
+	return svc.notifier.Deliveries(limit)
+}
+
+func(svc *LinkService) notifyStatusChange(link string, old, new models.LinkResult) {
+	event := models.StatusChangeEvent{
+		Type: models.EventLinkDown,
+		Link: link,
+		OldStatus: old.Status,
+		NewStatus: new.Status,
+		PreviousCheckedAt: old.CheckedAt,
+		CheckedAt: new.CheckedAt,
+		Packages: svc.storage.PackagesWithLink(link),
+		Result: new,
+	}
+	if new.Available() {
+		event.Type = models.EventLinkUp
+	}
+	svc.log.Info(
+		"Link status changed",
+		slog.String("link", link),
+		slog.String("old", old.Status),
+		slog.String("new", new.Status),
+	)
+	svc.notifier.Notify(event)
+}
@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	walFile = "wal.log"
+	defaultSnapshotInterval = 5 * time.Minute
+)
+
+var errStorageClosed = errors.New("StorageIsClosed")
+
+const (
+	opWritePackage = "write_package"
+	opUpdateStatus = "update_status"
+	opValidateCache = "validate_cache"
+	opDeletePackage = "delete_package"
+	opPinPackage = "pin_package"
+)
+
+// DiskStorage keeps the in-memory Storage durable. Every mutation is appended
+// to a write-ahead log before it becomes visible, and is dropped if that
+// fails. The whole state is periodically written to a snapshot after which
+// the log is truncated. Mutations are serialized by mutex, so a mutation that
+// was checked before it was logged still applies after.
+type DiskStorage struct {
+	*Storage
+	dir string
+	syncWrites bool
+	wal *os.File
+	mutex sync.Mutex
+	done chan struct{}
+	wg sync.WaitGroup
+	closed atomic.Bool
+}
+
+type walRecord struct {
+	Op string `json:"op"`
+	ID models.PackageID `json:"id,omitempty"`
+	Links []string `json:"links,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	Owner string `json:"owner,omitempty"`
+	Pinned bool `json:"pinned,omitempty"`
+	Statuses map[string]models.LinkResult `json:"statuses,omitempty"`
+}
+
+type snapshot struct {
+	ID int `json:"id"`
+	Packages map[models.PackageID]snapshotPackage `json:"packages"`
+	// Links is the package list of snapshots written before packages had a
+	// creation time. It is only read.
+	Links map[int][]string `json:"links,omitempty"`
+	// Expired are the evicted IDs, oldest first.
+	Expired []models.PackageID `json:"expired,omitempty"`
+	// Cache is ordered from the least to the most recently used entry.
+	Cache []snapshotEntry `json:"cache"`
+	History map[string][]models.HistoryPoint `json:"history"`
+}
+
+type snapshotPackage struct {
+	Links []string `json:"links"`
+	CreatedAt time.Time `json:"created_at"`
+	Owner string `json:"owner,omitempty"`
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+type snapshotEntry struct {
+	Key string `json:"key"`
+	Value models.LinkResult `json:"value"`
+}
+
+func NewDiskStorage(cfg config.StorageConfig, log *slog.Logger) (*DiskStorage, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("StoragePathIsEmpty")
+	}
+	if err := os.MkdirAll(cfg.Path, 0755); err != nil {
+		return nil, err
+	}
+
+	storage := &DiskStorage{
+		Storage: NewStorage(cfg, log),
+		dir: cfg.Path,
+		syncWrites: cfg.SyncWrites,
+		done: make(chan struct{}),
+	}
+
+	if err := storage.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := storage.replayWAL(); err != nil {
+		return nil, err
+	}
+	// The log holds packages, not evictions: the policy evicts them again.
+	storage.packages.restored()
+
+	wal, err := os.OpenFile(storage.path(walFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	storage.wal = wal
+
+	interval := cfg.SnapshotInterval
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+	storage.wg.Add(1)
+	go storage.snapshotLoop(interval)
+
+	log.Info(
+		"Disk storage loaded",
+		slog.String("path", cfg.Path),
+		slog.Int("packages", storage.packages.len()),
+		slog.Int("cached", storage.cache.len()),
+	)
+	return storage, nil
+}
+
+func(s *DiskStorage) WriteLinksPackage(links []string, owner string) (models.PackageID, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.packages.makeRoom(); err != nil {
+		return "", err
+	}
+	pkg := newLinksPackage(links, owner)
+	id := s.packages.newID()
+	err := s.appendWAL(walRecord{Op: opWritePackage, ID: id, Links: pkg.links, CreatedAt: pkg.createdAt, Owner: pkg.owner})
+	if err != nil {
+		return "", err
+	}
+	if err := s.packages.insert(id, pkg); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func(s *DiskStorage) DeletePackage(packageID models.PackageID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.packages.get(packageID); err != nil {
+		return err
+	}
+	if err := s.appendWAL(walRecord{Op: opDeletePackage, ID: packageID}); err != nil {
+		return err
+	}
+	return s.Storage.DeletePackage(packageID)
+}
+
+func(s *DiskStorage) PinPackage(packageID models.PackageID, pinned bool) (models.LinksPackage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.packages.get(packageID); err != nil {
+		return models.LinksPackage{}, err
+	}
+	if err := s.appendWAL(walRecord{Op: opPinPackage, ID: packageID, Pinned: pinned}); err != nil {
+		return models.LinksPackage{}, err
+	}
+	return s.Storage.PinPackage(packageID, pinned)
+}
+
+func(s *DiskStorage) ValidateCache(newValues map[string]models.LinkResult) {
+	s.updateStatus(opValidateCache, newValues)
+}
+
+func(s *DiskStorage) UpdateLinksInfo(links map[string]models.LinkResult) {
+	s.updateStatus(opUpdateStatus, links)
+}
+
+// Ready fails once the storage is closed. The snapshot and the log are loaded
+// by NewDiskStorage.
+func(s *DiskStorage) Ready() error {
+	if s.closed.Load() {
+		return errStorageClosed
+	}
+	return nil
+}
+
+// Close stops the snapshot loop, writes a final snapshot and releases the log
+// file. Calls after the first do nothing.
+func(s *DiskStorage) Close() error {
+	if !s.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	close(s.done)
+	s.wg.Wait()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := s.snapshot()
+	if closeErr := s.wal.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// updateStatus logs the results with op, which apply replays with the
+// matching method of Storage, and applies them.
+func(s *DiskStorage) updateStatus(op string, values map[string]models.LinkResult) {
+	if len(values) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record := walRecord{Op: op, Statuses: values}
+	err := s.appendWAL(record)
+	if err != nil {
+		s.log.Error(
+			"WritingWALError",
+			slog.String("component", "storage/disk"),
+			slog.Int("dropped", len(values)),
+			slog.Any("error", err),
+		)
+		return
+	}
+	s.apply(record)
+}
+
+func(s *DiskStorage) appendWAL(record walRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := s.wal.Write(data); err != nil {
+		return err
+	}
+	if s.syncWrites {
+		return s.wal.Sync()
+	}
+	return nil
+}
+
+func(s *DiskStorage) snapshotLoop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			err := s.snapshot()
+			s.mutex.Unlock()
+			if err != nil {
+				s.log.Error(
+					"WritingSnapshotError",
+					slog.String("component", "storage/disk"),
+					slog.Any("error", err),
+				)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// snapshot writes the current state next to the old snapshot, atomically
+// replaces it and truncates the log. The caller must hold s.mutex.
+func(s *DiskStorage) snapshot() error {
+	// Aged packages are evicted first, to be remembered as expired.
+	s.packages.evict()
+	packages := s.packages.all()
+	state := snapshot{
+		ID: int(s.packages.lastID.Load()),
+		Packages: make(map[models.PackageID]snapshotPackage, len(packages)),
+		Expired: s.packages.expiredIDs(),
+		History: s.history.all(),
+	}
+	for id, pkg := range packages {
+		state.Packages[id] = snapshotPackage{Links: pkg.links, CreatedAt: pkg.createdAt, Owner: pkg.owner, Pinned: pkg.pinned}
+	}
+	for _, e := range s.cache.entries() {
+		state.Cache = append(state.Cache, snapshotEntry{Key: e.key, Value: e.value})
+	}
+
+	tmp, err := os.CreateTemp(s.dir, snapshotFile + ".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(state); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(snapshotFile)); err != nil {
+		return err
+	}
+
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	return s.wal.Sync()
+}
+
+func(s *DiskStorage) loadSnapshot() error {
+	file, err := os.Open(s.path(snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var state snapshot
+	if err := json.NewDecoder(file).Decode(&state); err != nil {
+		return fmt.Errorf("SnapshotDecodingError: %w", err)
+	}
+
+	s.packages.reserve(state.ID)
+	for id, links := range state.Links {
+		s.packages.put(models.NumericPackageID(id), &linksPackage{links: links})
+	}
+	for id, pkg := range state.Packages {
+		s.packages.put(id, &linksPackage{links: pkg.Links, createdAt: pkg.CreatedAt, owner: pkg.Owner, pinned: pkg.Pinned})
+	}
+	s.packages.restoreExpired(state.Expired)
+	for _, e := range state.Cache {
+		s.cache.put(e.Key, e.Value)
+	}
+	s.history.restore(state.History)
+	return nil
+}
+
+// replayWAL applies the records written after the last snapshot. A torn
+// record at the end of the log (e.g. after a crash) ends the replay.
+func(s *DiskStorage) replayWAL() error {
+	file, err := os.Open(s.path(walFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	replayed := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) != 0 {
+				s.log.Warn("Skipping incomplete WAL record", slog.String("component", "storage/disk"))
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			s.log.Warn(
+				"Skipping corrupted WAL tail",
+				slog.String("component", "storage/disk"),
+				slog.Any("error", err),
+			)
+			break
+		}
+		s.apply(record)
+		replayed++
+	}
+
+	s.log.Info("WAL replayed", slog.Int("records", replayed))
+	return nil
+}
+
+func(s *DiskStorage) apply(record walRecord) {
+	switch record.Op {
+	case opWritePackage:
+		s.packages.put(record.ID, &linksPackage{links: record.Links, createdAt: record.CreatedAt, owner: record.Owner})
+	case opDeletePackage:
+		s.packages.remove(record.ID)
+	case opPinPackage:
+		s.packages.restorePin(record.ID, record.Pinned)
+	case opUpdateStatus:
+		s.Storage.UpdateLinksInfo(record.Statuses)
+	case opValidateCache:
+		s.Storage.ValidateCache(record.Statuses)
+	}
+}
+
+func(s *DiskStorage) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
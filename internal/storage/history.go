@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+const (
+	defaultHistoryRetention = 30 * 24 * time.Hour
+	defaultHistoryRawRetention = 24 * time.Hour
+	defaultHistoryResolution = time.Hour
+)
+
+// linkHistory is an append-only log of check results per link. Points older
+// than rawRetention are merged into buckets of resolution, points older than
+// retention are dropped. Every resolution all links are compacted, so the
+// links that are no longer checked are forgotten once their points expire.
+type linkHistory struct {
+	retention time.Duration
+	rawRetention time.Duration
+	resolution time.Duration
+	mutex sync.RWMutex
+	links map[string]*linkPoints
+	sweptAt time.Time
+}
+
+type linkPoints struct {
+	points []models.HistoryPoint
+	compactedAt time.Time
+}
+
+func newLinkHistory(cfg config.StorageConfig) *linkHistory {
+	h := &linkHistory{
+		retention: cfg.HistoryRetention,
+		rawRetention: cfg.HistoryRawRetention,
+		resolution: cfg.HistoryResolution,
+		links: make(map[string]*linkPoints),
+	}
+	if h.retention <= 0 {
+		h.retention = defaultHistoryRetention
+	}
+	if h.rawRetention <= 0 {
+		h.rawRetention = defaultHistoryRawRetention
+	}
+	if h.resolution <= 0 {
+		h.resolution = defaultHistoryResolution
+	}
+	return h
+}
+
+func(h *linkHistory) append(link string, result models.LinkResult) {
+	point := models.HistoryPoint{
+		Time: result.CheckedAt,
+		Checks: 1,
+		LatencyMS: result.LatencyMS,
+		MaxLatencyMS: result.LatencyMS,
+		StatusCode: result.StatusCode,
+		ErrorClass: result.ErrorClass,
+	}
+	if result.Available() {
+		point.Up = 1
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	entry, ok := h.links[link]
+	if !ok {
+		entry = &linkPoints{compactedAt: time.Now()}
+		h.links[link] = entry
+	}
+	// Concurrent checks may finish out of order, keep the points sorted.
+	i, _ := slices.BinarySearchFunc(entry.points, point.Time, func(p models.HistoryPoint, t time.Time) int {
+		return p.Time.Compare(t)
+	})
+	entry.points = slices.Insert(entry.points, i, point)
+
+	now := time.Now()
+	if now.Sub(h.sweptAt) >= h.resolution {
+		h.sweep(now)
+	} else if now.Sub(entry.compactedAt) >= h.resolution {
+		entry.points = h.compact(entry.points, now)
+		entry.compactedAt = now
+	}
+}
+
+// get returns a copy of the points with Time in [from, to).
+func(h *linkHistory) get(link string, from, to time.Time) []models.HistoryPoint {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	entry, ok := h.links[link]
+	if !ok {
+		return []models.HistoryPoint{}
+	}
+	now := time.Now()
+	entry.points = h.compact(entry.points, now)
+	entry.compactedAt = now
+	if len(entry.points) == 0 {
+		delete(h.links, link)
+	}
+
+	res := make([]models.HistoryPoint, 0)
+	for _, point := range entry.points {
+		if !point.Time.Before(from) && point.Time.Before(to) {
+			res = append(res, point)
+		}
+	}
+	return res
+}
+
+// sweep compacts the points of every link and forgets the links left without
+// any. The caller must hold h.mutex.
+func(h *linkHistory) sweep(now time.Time) {
+	h.sweptAt = now
+	for link, entry := range h.links {
+		entry.points = h.compact(entry.points, now)
+		entry.compactedAt = now
+		if len(entry.points) == 0 {
+			delete(h.links, link)
+		}
+	}
+}
+
+// compact drops expired points and downsamples the old raw ones.
+func(h *linkHistory) compact(points []models.HistoryPoint, now time.Time) []models.HistoryPoint {
+	expired := now.Add(-h.retention)
+	start := 0
+	for start < len(points) && points[start].Time.Before(expired) {
+		start++
+	}
+	points = points[start:]
+
+	rawFrom := now.Add(-h.rawRetention)
+	res := make([]models.HistoryPoint, 0, len(points))
+	for _, point := range points {
+		if !point.Time.Before(rawFrom) {
+			res = append(res, point)
+			continue
+		}
+		bucket := point.Time.Truncate(h.resolution)
+		last := len(res) - 1
+		if last >= 0 && res[last].Time.Equal(bucket) {
+			res[last] = merge(res[last], point)
+			continue
+		}
+		point.Time = bucket
+		res = append(res, point)
+	}
+	return res
+}
+
+func merge(bucket, point models.HistoryPoint) models.HistoryPoint {
+	checks := bucket.Checks + point.Checks
+	bucket.LatencyMS = (bucket.LatencyMS * int64(bucket.Checks) + point.LatencyMS * int64(point.Checks)) / int64(checks)
+	bucket.MaxLatencyMS = max(bucket.MaxLatencyMS, point.MaxLatencyMS)
+	bucket.Checks = checks
+	bucket.Up += point.Up
+	bucket.StatusCode = point.StatusCode
+	bucket.ErrorClass = point.ErrorClass
+	return bucket
+}
+
+// all sweeps the history and returns a copy of it for snapshots.
+func(h *linkHistory) all() map[string][]models.HistoryPoint {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.sweep(time.Now())
+	res := make(map[string][]models.HistoryPoint, len(h.links))
+	for link, entry := range h.links {
+		res[link] = slices.Clone(entry.points)
+	}
+	return res
+}
+
+func(h *linkHistory) restore(history map[string][]models.HistoryPoint) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for link, points := range history {
+		h.links[link] = &linkPoints{points: points, compactedAt: time.Now()}
+	}
+}
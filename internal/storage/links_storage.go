@@ -2,48 +2,87 @@ package storage
 
 import (
 	"container/list"
-	"fmt"
 	"log/slog"
-	"strings"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+	"github.com/behummble/29-11-2025/internal/urlnorm"
 )
 
+const defaultCacheTTL = 30 * time.Minute
+
+// Storage is safe for concurrent use.
 type Storage struct {
-	links map[int][]string
+	packages *packageStore
 	cache  *lruCache
+	history *linkHistory
+	// ttl is how long a cached status counts as fresh after its check.
+	ttl time.Duration
 	log *slog.Logger
-	id int
+}
+
+type linksPackage struct {
+	links []string
+	createdAt time.Time
+	owner string
+	pinned bool
 }
 
 func NewStorage(cfg config.StorageConfig, log *slog.Logger) *Storage {
-	return &Storage{
-		links: make(map[int][]string, cfg.LinksSize),
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	storage := &Storage{
+		packages: newPackageStore(cfg),
 		cache: newLRUCache(cfg.CacheSize),
+		history: newLinkHistory(cfg),
+		ttl: ttl,
 		log: log,
 	}
+	storage.registerGauges()
+	return storage
+}
+
+// Ready reports that the storage can serve; an in-memory one always can.
+func(s *Storage) Ready() error {
+	return nil
+}
+
+// WriteLinksPackage stores the canonical keys of the links, without duplicates.
+// owner is the client that created the package, empty without authentication.
+func(s *Storage) WriteLinksPackage(links []string, owner string) (models.PackageID, error) {
+	return s.packages.add(newLinksPackage(links, owner))
 }
 
-func(s *Storage) WriteLinksPackage(links []string) (int, error) {
-	for i := 0; i < len(links); i++ {
-		links[i] = strings.ToLower(links[i])
+func newLinksPackage(links []string, owner string) *linksPackage {
+	keys := make([]string, 0, len(links))
+	seen := make(map[string]struct{}, len(links))
+	for _, link := range links {
+		key := urlnorm.Key(link)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
 	}
-	s.id++
-	s.links[s.id] = links
-	return s.id, nil
+	return &linksPackage{links: keys, createdAt: time.Now().UTC(), owner: owner}
 }
 
-func(s *Storage) Links(packageID int) (map[string]string, []string, error) {
-	links, ok := s.links[packageID]
-	if !ok {
-		return nil, nil, fmt.Errorf("PackageNotFound: %d", packageID)
+func(s *Storage) Links(packageID models.PackageID) (map[string]models.LinkResult, []string, error) {
+	pkg, err := s.packages.get(packageID)
+	if err != nil {
+		return nil, nil, err
 	}
-	res := make(map[string]string, len(links))
+	links := pkg.links
+	res := make(map[string]models.LinkResult, len(links))
 	notInCache := make([]string, 0, len(links))
 	for _, link := range links {
 		value, ok := s.cache.get(link)
-		if !ok {
+		if !ok || !s.fresh(value) {
 			notInCache = append(notInCache, link)
 		}
 		res[link] = value
@@ -51,11 +90,71 @@ func(s *Storage) Links(packageID int) (map[string]string, []string, error) {
 	return res, notInCache, nil
 }
 
-func(s *Storage) LinksStatus(links []string) map[string]string {
-	res := make(map[string]string, len(links))
+func(s *Storage) Package(packageID models.PackageID) (models.LinksPackage, error) {
+	pkg, err := s.packages.get(packageID)
+	if err != nil {
+		return models.LinksPackage{}, err
+	}
+	return pkg.model(packageID), nil
+}
+
+// PinPackage keeps the package regardless of the retention policy, or
+// releases it to the policy again.
+func(s *Storage) PinPackage(packageID models.PackageID, pinned bool) (models.LinksPackage, error) {
+	pkg, err := s.packages.pin(packageID, pinned)
+	if err != nil {
+		return models.LinksPackage{}, err
+	}
+	return pkg.model(packageID), nil
+}
+
+// Packages returns a page of the packages matching the filter, ordered by ID,
+// and the number of matching packages.
+func(s *Storage) Packages(filter models.PackageFilter) ([]models.LinksPackage, int) {
+	key := ""
+	if filter.Link != "" {
+		key = urlnorm.Key(filter.Link)
+	}
+	packages := s.packages.all()
+	ids := make([]models.PackageID, 0, len(packages))
+	for id, pkg := range packages {
+		if filter.Owner != "" && pkg.owner != filter.Owner {
+			continue
+		}
+		if key != "" && !slices.Contains(pkg.links, key) {
+			continue
+		}
+		if !filter.CreatedAfter.IsZero() && !pkg.createdAt.After(filter.CreatedAfter) {
+			continue
+		}
+		if !filter.CreatedBefore.IsZero() && !pkg.createdAt.Before(filter.CreatedBefore) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, models.ComparePackageIDs)
+
+	total := len(ids)
+	ids = ids[min(filter.Offset, total):]
+	if filter.Limit > 0 && filter.Limit < len(ids) {
+		ids = ids[:filter.Limit]
+	}
+	res := make([]models.LinksPackage, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, packages[id].model(id))
+	}
+	return res, total
+}
+
+func(s *Storage) DeletePackage(packageID models.PackageID) error {
+	return s.packages.delete(packageID)
+}
+
+func(s *Storage) LinksStatus(links []string) map[string]models.LinkResult {
+	res := make(map[string]models.LinkResult, len(links))
 	for _, v := range links {
-		status, ok := s.cache.get(strings.ToLower(v))
-		if ok {
+		status, ok := s.cache.get(urlnorm.Key(v))
+		if ok && s.fresh(status) {
 			res[v] = status
 		}
 	}
@@ -63,19 +162,68 @@ func(s *Storage) LinksStatus(links []string) map[string]string {
 	return res
 }
 
-func(s *Storage) ValidateCache(newValues map[string]string) {
+// ValidateCache refreshes the results of the links still in the cache and
+// appends them to the history. Links evicted since are not cached again.
+func(s *Storage) ValidateCache(newValues map[string]models.LinkResult) {
 	for key, value := range newValues {
-		s.cache.put(key, value)
+		if value.CheckedAt.IsZero() {
+			value.CheckedAt = time.Now().UTC()
+		}
+		value.FromCache = false
+		key = urlnorm.Key(key)
+		if s.cache.refresh(key, value) {
+			s.history.append(key, value)
+		}
+	}
+}
+
+// PackagesWithLink returns the IDs of the packages containing the link.
+func(s *Storage) PackagesWithLink(link string) []models.PackageID {
+	key := urlnorm.Key(link)
+	res := make([]models.PackageID, 0)
+	for id, pkg := range s.packages.all() {
+		if slices.Contains(pkg.links, key) {
+			res = append(res, id)
+		}
 	}
+	slices.SortFunc(res, models.ComparePackageIDs)
+	return res
 }
 
-func(s *Storage) AllLinks() map[string]string {
+// AllLinks returns every cached status, stale ones included.
+func(s *Storage) AllLinks() map[string]models.LinkResult {
 	return s.cache.allKeys()
 }
 
-func(s *Storage) UpdateLinksInfo(links map[string]string) {
+// UpdateLinksInfo caches new check results and appends them to the history.
+func(s *Storage) UpdateLinksInfo(links map[string]models.LinkResult) {
 	for key, value := range links {
+		if value.CheckedAt.IsZero() {
+			value.CheckedAt = time.Now().UTC()
+		}
+		value.FromCache = false
+		key = urlnorm.Key(key)
 		s.cache.put(key, value)
+		s.history.append(key, value)
+	}
+}
+
+// History returns the check history of the link between from and to.
+func(s *Storage) History(link string, from, to time.Time) []models.HistoryPoint {
+	return s.history.get(urlnorm.Key(link), from, to)
+}
+
+func(s *Storage) fresh(value models.LinkResult) bool {
+	return time.Since(value.CheckedAt) <= s.ttl
+}
+
+func(p *linksPackage) model(id models.PackageID) models.LinksPackage {
+	return models.LinksPackage{
+		ID: id,
+		Links: slices.Clone(p.links),
+		CreatedAt: p.createdAt,
+		Owner: p.owner,
+		Pinned: p.pinned,
 	}
 }
 
@@ -88,7 +236,7 @@ type lruCache struct {
 
 type entry struct {
 	key   string
-	value string
+	value models.LinkResult
 }
 
 func newLRUCache(capacity int) *lruCache {
@@ -102,18 +250,20 @@ func newLRUCache(capacity int) *lruCache {
 	}
 }
 
-func (lru *lruCache) get(key string) (string, bool) {
+func (lru *lruCache) get(key string) (models.LinkResult, bool) {
 	lru.mutex.Lock()
 	defer lru.mutex.Unlock()
 
 	if elem, exists := lru.cache[key]; exists {
 		lru.evictList.MoveToFront(elem)
+		cacheHits.Inc()
 		return elem.Value.(*entry).value, true
 	}
-	return "", false
+	cacheMisses.Inc()
+	return models.LinkResult{}, false
 }
 
-func (lru *lruCache) put(key, value string) {
+func (lru *lruCache) put(key string, value models.LinkResult) {
 	lru.mutex.Lock()
 	defer lru.mutex.Unlock()
 
@@ -131,10 +281,25 @@ func (lru *lruCache) put(key, value string) {
 	lru.cache[key] = elem
 }
 
+// refresh replaces the value of a cached key, without making it recently
+// used. It reports whether the key was cached.
+func (lru *lruCache) refresh(key string, value models.LinkResult) bool {
+	lru.mutex.Lock()
+	defer lru.mutex.Unlock()
+
+	elem, exists := lru.cache[key]
+	if !exists {
+		return false
+	}
+	elem.Value.(*entry).value = value
+	return true
+}
+
 func (lru *lruCache) evict() {
 	elem := lru.evictList.Back()
 	if elem != nil {
 		lru.removeElement(elem)
+		cacheEvictions.Inc()
 	}
 }
 
@@ -151,10 +316,24 @@ func (lru *lruCache) len() int {
 	return lru.evictList.Len()
 }
 
-func (lru *lruCache) allKeys() map[string]string {
-	res := make(map[string]string, lru.len())
+func (lru *lruCache) allKeys() map[string]models.LinkResult {
+	lru.mutex.RLock()
+	defer lru.mutex.RUnlock()
+
+	res := make(map[string]models.LinkResult, lru.evictList.Len())
 	for key, elem := range lru.cache {
 		res[key] = elem.Value.(*entry).value
 	}
 	return res
-}
\ No newline at end of file
+}
+// entries returns a copy of the cache content ordered from the least to the most recently used.
+func (lru *lruCache) entries() []entry {
+	lru.mutex.RLock()
+	defer lru.mutex.RUnlock()
+
+	res := make([]entry, 0, lru.evictList.Len())
+	for elem := lru.evictList.Back(); elem != nil; elem = elem.Prev() {
+		res = append(res, *elem.Value.(*entry))
+	}
+	return res
+}
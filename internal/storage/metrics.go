@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"github.com/behummble/29-11-2025/internal/metrics"
+)
+
+var (
+	cacheHits = metrics.NewCounterVec("links_cache_hits_total", "Lookups of link statuses found in the cache.")
+	cacheMisses = metrics.NewCounterVec("links_cache_misses_total", "Lookups of link statuses missing from the cache.")
+	cacheEvictions = metrics.NewCounterVec("links_cache_evictions_total", "Link statuses evicted from the full cache.")
+)
+
+// registerGauges exposes the sizes of the storage. A storage created later
+// replaces the gauges of the previous one.
+func(s *Storage) registerGauges() {
+	metrics.NewGaugeFunc("links_cache_entries", "Link statuses in the cache.", func() float64 {
+		return float64(s.cache.len())
+	})
+	metrics.NewGaugeFunc("links_stored_packages", "Link packages in the storage.", func() float64 {
+		return float64(s.packages.len())
+	})
+}
@@ -0,0 +1,336 @@
+package storage
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+// expiredIDsLimit is how many evicted IDs are remembered to be reported as
+// expired; older ones are reported as not found.
+const expiredIDsLimit = 10000
+
+// packageStore keeps the link packages for concurrent requests and evicts
+// them by the retention policy. Stored packages are replaced rather than
+// modified, so they can be read after the lock is released.
+type packageStore struct {
+	mutex sync.RWMutex
+	packages map[models.PackageID]*linksPackage
+	// order holds the IDs from the oldest package. It may hold deleted ones,
+	// which are dropped when eviction reaches them.
+	order []models.PackageID
+	// expired holds the last evicted IDs; expiredOrder keeps them oldest first.
+	expired map[models.PackageID]struct{}
+	expiredOrder []models.PackageID
+	maxPackages int
+	maxAge time.Duration
+	// opaqueIDs issues UUIDv7 instead of sequential IDs. Sequential IDs of
+	// restored packages are still found unless rejectNumeric is set.
+	opaqueIDs bool
+	rejectNumeric bool
+	// lastID is the last allocated sequential ID; IDs are never reused.
+	lastID atomic.Int64
+	now func() time.Time
+}
+
+func newPackageStore(cfg config.StorageConfig) *packageStore {
+	return &packageStore{
+		packages: make(map[models.PackageID]*linksPackage, max(cfg.LinksSize, 0)),
+		expired: make(map[models.PackageID]struct{}),
+		maxPackages: cfg.LinksSize,
+		maxAge: cfg.PackageMaxAge,
+		opaqueIDs: cfg.PackageIDs == config.PackageIDsUUIDv7,
+		rejectNumeric: cfg.PackageIDs == config.PackageIDsUUIDv7 && cfg.RejectNumericIDs,
+		now: time.Now,
+	}
+}
+
+// add stores the package under a new ID.
+func(p *packageStore) add(pkg *linksPackage) (models.PackageID, error) {
+	id := p.newID()
+	if err := p.insert(id, pkg); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// newID allocates the ID of a new package.
+func(p *packageStore) newID() models.PackageID {
+	if p.opaqueIDs {
+		return newUUIDv7(p.now())
+	}
+	return models.NumericPackageID(int(p.lastID.Add(1)))
+}
+
+// makeRoom evicts the packages beyond the policy to make room for one more.
+// If every other package is pinned there is none.
+func(p *packageStore) makeRoom() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.makeRoomLocked()
+}
+
+// makeRoomLocked is makeRoom for a caller that holds p.mutex.
+func(p *packageStore) makeRoomLocked() error {
+	p.evictLocked(1)
+	if p.maxPackages > 0 && len(p.packages) >= p.maxPackages {
+		return fmt.Errorf("%w: %d pinned packages", models.ErrPackageStoreFull, len(p.packages))
+	}
+	return nil
+}
+
+// insert stores the package under a new ID from newID. The new package itself
+// is never evicted: if there is no room for it, it is not stored.
+func(p *packageStore) insert(id models.PackageID, pkg *linksPackage) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.makeRoomLocked(); err != nil {
+		return err
+	}
+	p.packages[id] = pkg
+	p.order = append(p.order, id)
+	return nil
+}
+
+// put stores the package under a known ID, as restored from disk. Later
+// sequential IDs are allocated after it. Once every package is restored,
+// restored sorts them and applies the policy.
+func(p *packageStore) put(id models.PackageID, pkg *linksPackage) {
+	p.mutex.Lock()
+	if _, ok := p.packages[id]; !ok {
+		p.order = append(p.order, id)
+	}
+	p.packages[id] = pkg
+	p.mutex.Unlock()
+	if n, ok := id.Numeric(); ok {
+		p.reserve(n)
+	}
+}
+
+// restored orders the restored packages from the oldest and evicts the ones
+// beyond the policy.
+func(p *packageStore) restored() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.order = slices.DeleteFunc(p.order, func(id models.PackageID) bool {
+		_, ok := p.packages[id]
+		return !ok
+	})
+	slices.SortFunc(p.order, func(a, b models.PackageID) int {
+		return cmp.Or(p.packages[a].createdAt.Compare(p.packages[b].createdAt), models.ComparePackageIDs(a, b))
+	})
+	p.evictLocked(0)
+}
+
+// reserve makes the IDs up to id unavailable for new packages.
+func(p *packageStore) reserve(id int) {
+	for {
+		last := p.lastID.Load()
+		if int64(id) <= last || p.lastID.CompareAndSwap(last, int64(id)) {
+			return
+		}
+	}
+}
+
+func(p *packageStore) get(id models.PackageID) (*linksPackage, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.getLocked(id)
+}
+
+// getLocked returns the package, or why there is none. The caller must hold p.mutex.
+func(p *packageStore) getLocked(id models.PackageID) (*linksPackage, error) {
+	if _, numeric := id.Numeric(); numeric && p.rejectNumeric {
+		return nil, fmt.Errorf("%w: %s", models.ErrPackageNotFound, id)
+	}
+	pkg, ok := p.packages[id]
+	if ok && !p.aged(pkg) {
+		return pkg, nil
+	}
+	if _, evicted := p.expired[id]; ok || evicted {
+		return nil, fmt.Errorf("%w: %s", models.ErrPackageExpired, id)
+	}
+	return nil, fmt.Errorf("%w: %s", models.ErrPackageNotFound, id)
+}
+
+func(p *packageStore) delete(id models.PackageID) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, err := p.getLocked(id); err != nil {
+		return err
+	}
+	p.removeLocked(id)
+	return nil
+}
+
+// remove deletes the package whatever its age, as replayed from disk.
+func(p *packageStore) remove(id models.PackageID) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.removeLocked(id)
+}
+
+// removeLocked deletes the package. The caller must hold p.mutex.
+func(p *packageStore) removeLocked(id models.PackageID) {
+	delete(p.packages, id)
+	if len(p.order) > 2 * len(p.packages) + 64 {
+		p.order = slices.DeleteFunc(p.order, func(id models.PackageID) bool {
+			_, ok := p.packages[id]
+			return !ok
+		})
+	}
+}
+
+func(p *packageStore) pin(id models.PackageID, pinned bool) (*linksPackage, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	pkg, err := p.getLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	return p.pinLocked(id, pkg, pinned), nil
+}
+
+// restorePin pins the package whatever its age, as replayed from disk.
+func(p *packageStore) restorePin(id models.PackageID, pinned bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if pkg, ok := p.packages[id]; ok {
+		p.pinLocked(id, pkg, pinned)
+	}
+}
+
+// pinLocked replaces the package with its pinned copy. The caller must hold p.mutex.
+func(p *packageStore) pinLocked(id models.PackageID, pkg *linksPackage, pinned bool) *linksPackage {
+	updated := *pkg
+	updated.pinned = pinned
+	p.packages[id] = &updated
+	return &updated
+}
+
+func(p *packageStore) len() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return len(p.packages)
+}
+
+// all returns a copy of the index of the packages within the policy.
+func(p *packageStore) all() map[models.PackageID]*linksPackage {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	res := make(map[models.PackageID]*linksPackage, len(p.packages))
+	for id, pkg := range p.packages {
+		if _, numeric := id.Numeric(); numeric && p.rejectNumeric {
+			continue
+		}
+		if !p.aged(pkg) {
+			res[id] = pkg
+		}
+	}
+	return res
+}
+
+// expiredIDs returns the remembered evicted IDs, oldest first.
+func(p *packageStore) expiredIDs() []models.PackageID {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return slices.Clone(p.expiredOrder)
+}
+
+// evict removes the packages beyond the policy and returns their number.
+func(p *packageStore) evict() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.evictLocked(0)
+}
+
+// evictLocked removes the oldest packages that are not pinned while there are
+// more than maxPackages, leaving room for room more, or they are older than
+// maxAge. The caller must hold p.mutex.
+func(p *packageStore) evictLocked(room int) int {
+	over := 0
+	if p.maxPackages > 0 {
+		over = len(p.packages) + room - p.maxPackages
+	}
+	var pinned []models.PackageID
+	evicted := 0
+	i := 0
+	for ; i < len(p.order); i++ {
+		id := p.order[i]
+		pkg, ok := p.packages[id]
+		if !ok {
+			continue
+		}
+		if pkg.pinned {
+			pinned = append(pinned, id)
+			continue
+		}
+		// Packages are ordered by age, so the rest are younger.
+		if over - evicted <= 0 && !p.aged(pkg) {
+			break
+		}
+		delete(p.packages, id)
+		p.remember(id)
+		evicted++
+	}
+	if i > 0 {
+		p.order = append(pinned, p.order[i:]...)
+	}
+	return evicted
+}
+
+// aged reports whether the package outlived maxAge. Packages restored
+// without a creation time never do.
+func(p *packageStore) aged(pkg *linksPackage) bool {
+	if p.maxAge <= 0 || pkg.pinned || pkg.createdAt.IsZero() {
+		return false
+	}
+	return p.now().Sub(pkg.createdAt) > p.maxAge
+}
+
+// remember records an evicted ID. The caller must hold p.mutex.
+func(p *packageStore) remember(id models.PackageID) {
+	if _, ok := p.expired[id]; ok {
+		return
+	}
+	p.expired[id] = struct{}{}
+	p.expiredOrder = append(p.expiredOrder, id)
+	if len(p.expiredOrder) > expiredIDsLimit {
+		delete(p.expired, p.expiredOrder[0])
+		p.expiredOrder = p.expiredOrder[1:]
+	}
+}
+
+// restoreExpired remembers the evicted IDs of a snapshot.
+func(p *packageStore) restoreExpired(ids []models.PackageID) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, id := range ids {
+		p.remember(id)
+	}
+}
+
+// newUUIDv7 returns a random UUID version 7: 48 bits of Unix milliseconds,
+// then 74 random bits, so that IDs sort by creation time but cannot be guessed.
+func newUUIDv7(now time.Time) models.PackageID {
+	var uuid [16]byte
+	rand.Read(uuid[6:])
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(now.UnixMilli()))
+	copy(uuid[:6], ms[2:])
+	uuid[6] = uuid[6] & 0x0f | 0x70
+	uuid[8] = uuid[8] & 0x3f | 0x80
+
+	text := hex.EncodeToString(uuid[:])
+	return models.PackageID(text[:8] + "-" + text[8:12] + "-" + text[12:16] + "-" + text[16:20] + "-" + text[20:])
+}
@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
 )
 
 func TestStorage_WriteAndReadLinksPackage(t *testing.T) {
@@ -13,13 +19,13 @@ func TestStorage_WriteAndReadLinksPackage(t *testing.T) {
 	
 	links := []string{"example.com", "google.com"}
 	
-	id, err := storage.WriteLinksPackage(links)
+	id, err := storage.WriteLinksPackage(links, "")
 	if err != nil {
 		t.Fatalf("WriteLinksPackage failed: %v", err)
 	}
 	
-	if id != 1 {
-		t.Errorf("Expected ID 1, got %d", id)
+	if id != "1" {
+		t.Errorf("Expected ID 1, got %s", id)
 	}
 	
 	cached, notCached, err := storage.Links(id)
@@ -35,9 +41,9 @@ func TestStorage_WriteAndReadLinksPackage(t *testing.T) {
 		t.Errorf("Expected 2 not cached links, got %d", len(notCached))
 	}
 	
-	storage.UpdateLinksInfo(map[string]string{
-		"example.com": "available",
-		"google.com":  "available",
+	storage.UpdateLinksInfo(map[string]models.LinkResult{
+		"example.com": {Status: "available"},
+		"google.com":  {Status: "available"},
 	})
 	
 	cached, notCached, err = storage.Links(id)
@@ -58,8 +64,8 @@ func TestStorage_LinksStatus(t *testing.T) {
 	cfg := config.StorageConfig{LinksSize: 100, CacheSize: 50}
 	storage := NewStorage(cfg, slog.Default())
 	
-	storage.UpdateLinksInfo(map[string]string{
-		"cached.com": "available",
+	storage.UpdateLinksInfo(map[string]models.LinkResult{
+		"cached.com": {Status: "available"},
 	})
 	
 	status := storage.LinksStatus([]string{"cached.com", "uncached.com"})
@@ -68,8 +74,114 @@ func TestStorage_LinksStatus(t *testing.T) {
 		t.Errorf("Expected 1 status, got %d", len(status))
 	}
 	
-	if status["cached.com"] != "available" {
-		t.Errorf("Expected 'available', got '%s'", status["cached.com"])
+	if status["cached.com"].Status != "available" {
+		t.Errorf("Expected 'available', got '%s'", status["cached.com"].Status)
+	}
+}
+
+func TestStorage_CanonicalKeys(t *testing.T) {
+	cfg := config.StorageConfig{LinksSize: 100, CacheSize: 50}
+	storage := NewStorage(cfg, slog.Default())
+
+	id, err := storage.WriteLinksPackage([]string{"Example.com/", "http://example.com", "example.com:8080/Path"}, "")
+	if err != nil {
+		t.Fatalf("WriteLinksPackage failed: %v", err)
+	}
+	storage.UpdateLinksInfo(map[string]models.LinkResult{
+		"https://EXAMPLE.com": {Status: "available"},
+	})
+
+	cached, notCached, err := storage.Links(id)
+	if err != nil {
+		t.Fatalf("Links failed: %v", err)
+	}
+	if len(cached) != 2 {
+		t.Errorf("Expected 2 links in package, got %d", len(cached))
+	}
+	if cached["example.com"].Status != "available" {
+		t.Errorf("Expected 'available', got '%s'", cached["example.com"].Status)
+	}
+	if len(notCached) != 1 || notCached[0] != "example.com:8080/Path" {
+		t.Errorf("Expected example.com:8080/Path to be not cached, got %v", notCached)
+	}
+}
+
+func TestStorage_CacheTTL(t *testing.T) {
+	cfg := config.StorageConfig{LinksSize: 100, CacheSize: 50, CacheTTL: time.Minute}
+	storage := NewStorage(cfg, slog.Default())
+
+	storage.UpdateLinksInfo(map[string]models.LinkResult{
+		"fresh.com": {Status: "available"},
+		"stale.com": {Status: "available", CheckedAt: time.Now().Add(-2 * time.Minute)},
+	})
+
+	status := storage.LinksStatus([]string{"fresh.com", "stale.com"})
+	if _, ok := status["stale.com"]; ok {
+		t.Error("Expected stale.com to be expired")
+	}
+	if status["fresh.com"].CheckedAt.IsZero() {
+		t.Error("Expected check time to be set for fresh.com")
+	}
+
+	if _, ok := storage.AllLinks()["stale.com"]; !ok {
+		t.Error("Expected stale.com to stay in cache for revalidation")
+	}
+}
+
+func TestStorage_HistoryDownsampling(t *testing.T) {
+	cfg := config.StorageConfig{
+		LinksSize: 100,
+		CacheSize: 50,
+		HistoryRetention: 48 * time.Hour,
+		HistoryRawRetention: time.Hour,
+		HistoryResolution: time.Hour,
+	}
+	storage := NewStorage(cfg, slog.Default())
+
+	now := time.Now().UTC()
+	old := now.Add(-5 * time.Hour).Truncate(time.Hour)
+	checks := []models.LinkResult{
+		{Status: models.StatusAvaliable, LatencyMS: 100, CheckedAt: now.Add(-72 * time.Hour)},
+		{Status: models.StatusAvaliable, LatencyMS: 100, CheckedAt: old.Add(time.Minute)},
+		{Status: models.StatusNotAvaliable, LatencyMS: 300, CheckedAt: old.Add(2 * time.Minute)},
+		{Status: models.StatusAvaliable, LatencyMS: 50, CheckedAt: now.Add(-time.Minute)},
+	}
+	for _, check := range checks {
+		storage.UpdateLinksInfo(map[string]models.LinkResult{"example.com": check})
+	}
+
+	points := storage.History("example.com", now.Add(-100 * time.Hour), now)
+	if len(points) != 2 {
+		t.Fatalf("Expected expired point dropped and old ones merged into 2 points, got %+v", points)
+	}
+	bucket := points[0]
+	if !bucket.Time.Equal(old) || bucket.Checks != 2 || bucket.Up != 1 || bucket.LatencyMS != 200 || bucket.MaxLatencyMS != 300 {
+		t.Errorf("Unexpected bucket %+v", bucket)
+	}
+	if points[1].Checks != 1 || points[1].LatencyMS != 50 {
+		t.Errorf("Expected recent check to stay raw, got %+v", points[1])
+	}
+}
+
+func TestLinkHistory_Sweep(t *testing.T) {
+	history := newLinkHistory(config.StorageConfig{HistoryRetention: 48 * time.Hour})
+	now := time.Now().UTC()
+
+	history.append("gone.com", models.LinkResult{Status: models.StatusAvaliable, CheckedAt: now.Add(-time.Hour)})
+	history.restore(map[string][]models.HistoryPoint{
+		"expired.com": {{Time: now.Add(-72 * time.Hour), Checks: 1, Up: 1}},
+	})
+	history.append("example.com", models.LinkResult{Status: models.StatusAvaliable, CheckedAt: now})
+
+	all := history.all()
+	if _, ok := all["expired.com"]; ok {
+		t.Errorf("Expected the link with only expired points to be dropped, got %+v", all["expired.com"])
+	}
+	if len(all["gone.com"]) != 1 || len(all["example.com"]) != 1 {
+		t.Errorf("Expected the links with recent points to stay, got %+v", all)
+	}
+	if len(history.links) != 2 {
+		t.Errorf("Expected 2 links left in memory, got %d", len(history.links))
 	}
 }
 
@@ -77,7 +189,7 @@ func TestStorage_PackageNotFound(t *testing.T) {
 	cfg := config.StorageConfig{LinksSize: 100, CacheSize: 50}
 	storage := NewStorage(cfg, slog.Default())
 	
-	_, _, err := storage.Links(999)
+	_, _, err := storage.Links("999")
 	
 	if err == nil {
 		t.Error("Expected error for non-existent package")
@@ -88,12 +200,52 @@ func TestStorage_PackageNotFound(t *testing.T) {
 	}
 }
 
+func TestStorage_Packages(t *testing.T) {
+	cfg := config.StorageConfig{LinksSize: 100, CacheSize: 50}
+	storage := NewStorage(cfg, slog.Default())
+
+	storage.WriteLinksPackage([]string{"example.com"}, "")
+	storage.WriteLinksPackage([]string{"https://Example.com/", "google.com"}, "")
+	storage.WriteLinksPackage([]string{"github.com"}, "team-a")
+
+	packages, total := storage.Packages(models.PackageFilter{Link: "http://example.com"})
+	if total != 2 || len(packages) != 2 || packages[0].ID != "1" || packages[1].ID != "2" {
+		t.Errorf("Expected packages 1 and 2, got %v (total %d)", packages, total)
+	}
+
+	packages, total = storage.Packages(models.PackageFilter{Offset: 1, Limit: 1})
+	if total != 3 || len(packages) != 1 || packages[0].ID != "2" {
+		t.Errorf("Expected package 2 of 3, got %v (total %d)", packages, total)
+	}
+
+	packages, total = storage.Packages(models.PackageFilter{Owner: "team-a"})
+	if total != 1 || packages[0].ID != "3" || packages[0].Owner != "team-a" {
+		t.Errorf("Expected package 3 of team-a, got %v (total %d)", packages, total)
+	}
+
+	packages, _ = storage.Packages(models.PackageFilter{CreatedBefore: time.Now().Add(-time.Hour)})
+	if len(packages) != 0 {
+		t.Errorf("Expected no packages created an hour ago, got %v", packages)
+	}
+
+	if err := storage.DeletePackage("2"); err != nil {
+		t.Fatalf("DeletePackage failed: %v", err)
+	}
+	if _, err := storage.Package("2"); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected ErrPackageNotFound, got %v", err)
+	}
+	if err := storage.DeletePackage("2"); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected ErrPackageNotFound on second delete, got %v", err)
+	}
+}
+
 func TestLRUCache_Eviction(t *testing.T) {
 	cache := newLRUCache(2)
+	hits, misses, evictions := cacheHits.Value(), cacheMisses.Value(), cacheEvictions.Value()
 	
-	cache.put("key1", "value1")
-	cache.put("key2", "value2")
-	cache.put("key3", "value3")
+	cache.put("key1", models.LinkResult{Status: "value1"})
+	cache.put("key2", models.LinkResult{Status: "value2"})
+	cache.put("key3", models.LinkResult{Status: "value3"})
 	
 	_, ok := cache.get("key1")
 	if ok {
@@ -104,15 +256,459 @@ func TestLRUCache_Eviction(t *testing.T) {
 	if !ok {
 		t.Error("Expected key2 to be present")
 	}
-	if val != "value2" {
-		t.Errorf("Expected 'value2', got '%s'", val)
+	if val.Status != "value2" {
+		t.Errorf("Expected 'value2', got '%s'", val.Status)
 	}
 	
 	val, ok = cache.get("key3")
 	if !ok {
 		t.Error("Expected key3 to be present")
 	}
-	if val != "value3" {
-		t.Errorf("Expected 'value3', got '%s'", val)
+	if val.Status != "value3" {
+		t.Errorf("Expected 'value3', got '%s'", val.Status)
+	}
+	if cacheHits.Value() - hits != 2 || cacheMisses.Value() - misses != 1 || cacheEvictions.Value() - evictions != 1 {
+		t.Errorf("Expected 2 hits, 1 miss and 1 eviction counted, got %v, %v and %v",
+			cacheHits.Value() - hits, cacheMisses.Value() - misses, cacheEvictions.Value() - evictions)
+	}
+}
+func TestDiskStorage_RestoreAfterClose(t *testing.T) {
+	cfg := config.StorageConfig{LinksSize: 100, CacheSize: 50, Type: config.StorageDisk, Path: t.TempDir()}
+	storage, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+
+	id, err := storage.WriteLinksPackage([]string{"example.com", "google.com"}, "")
+	if err != nil {
+		t.Fatalf("WriteLinksPackage failed: %v", err)
+	}
+	storage.UpdateLinksInfo(map[string]models.LinkResult{"example.com": {Status: "available"}})
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Second Close failed: %v", err)
+	}
+
+	restored, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer restored.Close()
+
+	cached, notCached, err := restored.Links(id)
+	if err != nil {
+		t.Fatalf("Links failed: %v", err)
+	}
+	if cached["example.com"].Status != "available" {
+		t.Errorf("Expected 'available', got '%s'", cached["example.com"].Status)
+	}
+	if len(notCached) != 1 || notCached[0] != "google.com" {
+		t.Errorf("Expected google.com to be not cached, got %v", notCached)
+	}
+
+	nextID, err := restored.WriteLinksPackage([]string{"github.com"}, "")
+	if err != nil {
+		t.Fatalf("WriteLinksPackage failed: %v", err)
+	}
+	if nextID != "2" {
+		t.Errorf("Expected ID 2, got %s", nextID)
+	}
+}
+
+func TestDiskStorage_ReplayWAL(t *testing.T) {
+	cfg := config.StorageConfig{LinksSize: 100, CacheSize: 50, Type: config.StorageDisk, Path: t.TempDir()}
+	storage, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer storage.Close()
+
+	id, err := storage.WriteLinksPackage([]string{"example.com"}, "team-a")
+	if err != nil {
+		t.Fatalf("WriteLinksPackage failed: %v", err)
+	}
+	storage.UpdateLinksInfo(map[string]models.LinkResult{"example.com": {Status: "not available"}})
+	deletedID, _ := storage.WriteLinksPackage([]string{"google.com"}, "")
+	if err := storage.DeletePackage(deletedID); err != nil {
+		t.Fatalf("DeletePackage failed: %v", err)
+	}
+
+	// Opening the directory without closing the first instance emulates a crash:
+	// there is no snapshot yet, so the state has to come from the log.
+	replayed, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer replayed.Close()
+
+	status := replayed.LinksStatus([]string{"example.com"})
+	if status["example.com"].Status != "not available" {
+		t.Errorf("Expected 'not available', got '%s'", status["example.com"].Status)
+	}
+	if pkg, err := replayed.Package(id); err != nil || pkg.Owner != "team-a" {
+		t.Errorf("Expected package %s of team-a to be replayed, got %+v: %v", id, pkg, err)
+	}
+	if _, err := replayed.Package(deletedID); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected package %s to stay deleted, got %v", deletedID, err)
 	}
-}
\ No newline at end of file
+}
+
+func TestDiskStorage_ReplayValidateCache(t *testing.T) {
+	cfg := config.StorageConfig{LinksSize: 100, CacheSize: 1, Type: config.StorageDisk, Path: t.TempDir()}
+	storage, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer storage.Close()
+
+	now := time.Now().UTC()
+	storage.UpdateLinksInfo(map[string]models.LinkResult{"example.com": {Status: models.StatusAvaliable, CheckedAt: now.Add(-time.Minute)}})
+	storage.UpdateLinksInfo(map[string]models.LinkResult{"google.com": {Status: models.StatusAvaliable, CheckedAt: now.Add(-time.Minute)}})
+	// example.com was evicted by google.com while it was being revalidated.
+	storage.ValidateCache(map[string]models.LinkResult{
+		"example.com": {Status: models.StatusNotAvaliable, CheckedAt: now},
+		"google.com": {Status: models.StatusNotAvaliable, CheckedAt: now},
+	})
+
+	replayed, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer replayed.Close()
+
+	for _, s := range []*DiskStorage{storage, replayed} {
+		links := s.AllLinks()
+		if _, ok := links["example.com"]; ok || links["google.com"].Status != models.StatusNotAvaliable {
+			t.Errorf("Expected only google.com to be refreshed, got %+v", links)
+		}
+		if points := s.History("example.com", now.Add(-time.Hour), now.Add(time.Hour)); len(points) != 1 {
+			t.Errorf("Expected 1 history point of the evicted link, got %+v", points)
+		}
+		if points := s.History("google.com", now.Add(-time.Hour), now.Add(time.Hour)); len(points) != 2 {
+			t.Errorf("Expected 2 history points of the refreshed link, got %+v", points)
+		}
+	}
+}
+
+// writeConcurrently writes packages from many goroutines while others read,
+// and returns the IDs handed out.
+func writeConcurrently(t *testing.T, storage interface {
+	WriteLinksPackage(links []string, owner string) (models.PackageID, error)
+	Links(packageID models.PackageID) (map[string]models.LinkResult, []string, error)
+	Packages(filter models.PackageFilter) ([]models.LinksPackage, int)
+	UpdateLinksInfo(links map[string]models.LinkResult)
+	AllLinks() map[string]models.LinkResult
+}) []models.PackageID {
+	t.Helper()
+	const writers, perWriter = 8, 25
+
+	ids := make(chan models.PackageID, writers * perWriter)
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				link := fmt.Sprintf("site-%d-%d.com", w, i)
+				id, err := storage.WriteLinksPackage([]string{link}, "")
+				if err != nil {
+					t.Errorf("WriteLinksPackage failed: %v", err)
+					return
+				}
+				ids <- id
+				storage.UpdateLinksInfo(map[string]models.LinkResult{link: {Status: models.StatusAvaliable}})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				storage.Links(models.NumericPackageID(i + 1))
+				storage.Packages(models.PackageFilter{Limit: 10})
+				storage.AllLinks()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	res := make([]models.PackageID, 0, writers * perWriter)
+	for id := range ids {
+		res = append(res, id)
+	}
+	slices.SortFunc(res, models.ComparePackageIDs)
+	if len(slices.Compact(slices.Clone(res))) != writers * perWriter {
+		t.Errorf("Expected %d distinct IDs, got %v", writers * perWriter, res)
+	}
+	return res
+}
+
+func TestStorage_ConcurrentAccess(t *testing.T) {
+	storage := NewStorage(config.StorageConfig{CacheSize: 500}, slog.Default())
+	ids := writeConcurrently(t, storage)
+
+	if _, total := storage.Packages(models.PackageFilter{}); total != len(ids) {
+		t.Errorf("Expected %d packages, got %d", len(ids), total)
+	}
+	if links := storage.AllLinks(); len(links) != len(ids) {
+		t.Errorf("Expected %d cached links, got %d", len(ids), len(links))
+	}
+}
+
+func TestDiskStorage_ConcurrentAccess(t *testing.T) {
+	cfg := config.StorageConfig{CacheSize: 500, Type: config.StorageDisk, Path: t.TempDir(), SnapshotInterval: time.Millisecond}
+	storage, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	ids := writeConcurrently(t, storage)
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	restored, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer restored.Close()
+	for _, id := range ids {
+		if _, err := restored.Package(id); err != nil {
+			t.Errorf("Expected package %s to be restored: %v", id, err)
+		}
+	}
+	last, _ := ids[len(ids) - 1].Numeric()
+	if id, _ := restored.WriteLinksPackage([]string{"example.com"}, ""); id != models.NumericPackageID(last + 1) {
+		t.Errorf("Expected the next ID %d, got %s", last + 1, id)
+	}
+}
+
+func TestStorage_Retention(t *testing.T) {
+	storage := NewStorage(config.StorageConfig{LinksSize: 3, CacheSize: 10, PackageMaxAge: time.Hour}, slog.Default())
+	now := time.Now()
+	storage.packages.now = func() time.Time { return now }
+
+	pinnedID, _ := storage.WriteLinksPackage([]string{"pinned.com"}, "")
+	if _, err := storage.PinPackage(pinnedID, true); err != nil {
+		t.Fatalf("PinPackage failed: %v", err)
+	}
+	ids := make([]models.PackageID, 0, 4)
+	for _, link := range []string{"a.com", "b.com", "c.com", "d.com"} {
+		id, _ := storage.WriteLinksPackage([]string{link}, "")
+		ids = append(ids, id)
+	}
+
+	// Four packages over the limit of three: the oldest that is not pinned goes.
+	for _, id := range ids[:2] {
+		if _, err := storage.Package(id); !errors.Is(err, models.ErrPackageExpired) {
+			t.Errorf("Expected package %s to be expired, got %v", id, err)
+		}
+	}
+	if _, _, err := storage.Links(ids[0]); !errors.Is(err, models.ErrPackageExpired) {
+		t.Errorf("Expected Links of package %s to be expired, got %v", ids[0], err)
+	}
+	if _, err := storage.Package("100"); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected an unknown package not to be expired, got %v", err)
+	}
+	if pkg, err := storage.Package(pinnedID); err != nil || !pkg.Pinned {
+		t.Errorf("Expected the pinned package to be kept, got %+v: %v", pkg, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := storage.Package(ids[3]); !errors.Is(err, models.ErrPackageExpired) {
+		t.Errorf("Expected package %s to be expired by age, got %v", ids[3], err)
+	}
+	if _, total := storage.Packages(models.PackageFilter{}); total != 1 {
+		t.Errorf("Expected only the pinned package to be listed, got %d", total)
+	}
+	if _, err := storage.Package(pinnedID); err != nil {
+		t.Errorf("Expected the pinned package not to age, got %v", err)
+	}
+}
+
+func TestDiskStorage_RestoreRetention(t *testing.T) {
+	cfg := config.StorageConfig{LinksSize: 2, CacheSize: 10, Type: config.StorageDisk, Path: t.TempDir()}
+	storage, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	pinnedID, _ := storage.WriteLinksPackage([]string{"pinned.com"}, "")
+	if _, err := storage.PinPackage(pinnedID, true); err != nil {
+		t.Fatalf("PinPackage failed: %v", err)
+	}
+	expiredID, _ := storage.WriteLinksPackage([]string{"a.com"}, "")
+	keptID, _ := storage.WriteLinksPackage([]string{"b.com"}, "")
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The snapshot keeps the evicted IDs, the log replayed over it evicts again.
+	restored, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	nextID, _ := restored.WriteLinksPackage([]string{"c.com"}, "")
+	replayed, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer replayed.Close()
+	defer restored.Close()
+
+	for id, expected := range map[models.PackageID]error{pinnedID: nil, expiredID: models.ErrPackageExpired, keptID: models.ErrPackageExpired, nextID: nil} {
+		if _, err := replayed.Package(id); !errors.Is(err, expected) {
+			t.Errorf("Expected %v for package %s, got %v", expected, id, err)
+		}
+	}
+}
+
+func TestStorage_OpaqueIDs(t *testing.T) {
+	storage := NewStorage(config.StorageConfig{CacheSize: 10, PackageIDs: config.PackageIDsUUIDv7}, slog.Default())
+	now := time.Now()
+	storage.packages.now = func() time.Time { return now }
+
+	ids := make([]models.PackageID, 0, 3)
+	for _, link := range []string{"a.com", "b.com", "c.com"} {
+		id, _ := storage.WriteLinksPackage([]string{link}, "")
+		if _, ok := id.Numeric(); ok {
+			t.Fatalf("Expected an opaque ID, got %s", id)
+		}
+		if parsed, err := models.ParsePackageID(string(id)); err != nil || parsed != id {
+			t.Fatalf("Expected the ID %s to parse, got %s: %v", id, parsed, err)
+		}
+		ids = append(ids, id)
+		now = now.Add(time.Millisecond)
+	}
+	if ids[0][14] != '7' {
+		t.Errorf("Expected a version 7 UUID, got %s", ids[0])
+	}
+
+	packages, _ := storage.Packages(models.PackageFilter{})
+	listed := make([]models.PackageID, 0, len(packages))
+	for _, pkg := range packages {
+		listed = append(listed, pkg.ID)
+	}
+	if !slices.Equal(listed, ids) {
+		t.Errorf("Expected the packages in creation order %v, got %v", ids, listed)
+	}
+	if _, err := storage.Package("1"); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected no sequential package, got %v", err)
+	}
+}
+
+func TestDiskStorage_MigrateToOpaqueIDs(t *testing.T) {
+	cfg := config.StorageConfig{CacheSize: 10, Type: config.StorageDisk, Path: t.TempDir()}
+	storage, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	numericID, _ := storage.WriteLinksPackage([]string{"old.com"}, "")
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	cfg.PackageIDs = config.PackageIDsUUIDv7
+	migrated, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	opaqueID, _ := migrated.WriteLinksPackage([]string{"new.com"}, "")
+	if _, ok := opaqueID.Numeric(); ok {
+		t.Fatalf("Expected an opaque ID, got %s", opaqueID)
+	}
+	if _, err := migrated.Package(numericID); err != nil {
+		t.Errorf("Expected the sequential package to stay readable, got %v", err)
+	}
+	if err := migrated.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Once the clients have moved on, the sequential IDs can be turned off.
+	cfg.RejectNumericIDs = true
+	rejecting, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer rejecting.Close()
+	if _, err := rejecting.Package(numericID); !errors.Is(err, models.ErrPackageNotFound) {
+		t.Errorf("Expected the sequential package to be hidden, got %v", err)
+	}
+	if _, total := rejecting.Packages(models.PackageFilter{}); total != 1 {
+		t.Errorf("Expected only the opaque package to be listed, got %d", total)
+	}
+	if _, err := rejecting.Package(opaqueID); err != nil {
+		t.Errorf("Expected the opaque package to be restored, got %v", err)
+	}
+}
+
+func TestStorage_RetentionAllPinned(t *testing.T) {
+	disk, err := NewDiskStorage(config.StorageConfig{LinksSize: 1, CacheSize: 10, Type: config.StorageDisk, Path: t.TempDir()}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer disk.Close()
+
+	for name, storage := range map[string]interface {
+		WriteLinksPackage(links []string, owner string) (models.PackageID, error)
+		PinPackage(packageID models.PackageID, pinned bool) (models.LinksPackage, error)
+		Package(packageID models.PackageID) (models.LinksPackage, error)
+	}{
+		"memory": NewStorage(config.StorageConfig{LinksSize: 1, CacheSize: 10}, slog.Default()),
+		"disk": disk,
+	} {
+		pinnedID, _ := storage.WriteLinksPackage([]string{"pinned.com"}, "")
+		if _, err := storage.PinPackage(pinnedID, true); err != nil {
+			t.Fatalf("%s: PinPackage failed: %v", name, err)
+		}
+		if id, err := storage.WriteLinksPackage([]string{"a.com"}, ""); !errors.Is(err, models.ErrPackageStoreFull) {
+			t.Errorf("%s: expected the full store to reject the package, got %s: %v", name, id, err)
+		}
+		if _, err := storage.Package(pinnedID); err != nil {
+			t.Errorf("%s: expected the pinned package to be kept, got %v", name, err)
+		}
+
+		if _, err := storage.PinPackage(pinnedID, false); err != nil {
+			t.Fatalf("%s: PinPackage failed: %v", name, err)
+		}
+		id, err := storage.WriteLinksPackage([]string{"a.com"}, "")
+		if err != nil {
+			t.Fatalf("%s: expected the unpinned package to make room, got %v", name, err)
+		}
+		if _, err := storage.Package(id); err != nil {
+			t.Errorf("%s: expected the new package to be stored, got %v", name, err)
+		}
+	}
+}
+
+func TestDiskStorage_WALFailure(t *testing.T) {
+	cfg := config.StorageConfig{CacheSize: 10, Type: config.StorageDisk, Path: t.TempDir()}
+	storage, err := NewDiskStorage(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewDiskStorage failed: %v", err)
+	}
+	defer storage.Close()
+	id, _ := storage.WriteLinksPackage([]string{"example.com"}, "")
+
+	// Nothing that fails to reach the log may become visible.
+	storage.wal.Close()
+	if newID, err := storage.WriteLinksPackage([]string{"a.com"}, ""); err == nil {
+		t.Errorf("Expected the write to fail, got package %s", newID)
+	}
+	if _, total := storage.Packages(models.PackageFilter{}); total != 1 {
+		t.Errorf("Expected only the logged package, got %d", total)
+	}
+	if err := storage.DeletePackage(id); err == nil {
+		t.Error("Expected the delete to fail")
+	}
+	if _, err := storage.PinPackage(id, true); err == nil {
+		t.Error("Expected the pin to fail")
+	}
+	if pkg, err := storage.Package(id); err != nil || pkg.Pinned {
+		t.Errorf("Expected the package to be unchanged, got %+v: %v", pkg, err)
+	}
+	storage.UpdateLinksInfo(map[string]models.LinkResult{"example.com": {Status: models.StatusAvaliable}})
+	if cached := storage.LinksStatus([]string{"example.com"}); len(cached) != 0 {
+		t.Errorf("Expected the status not to be cached, got %v", cached)
+	}
+}
@@ -0,0 +1,218 @@
+package urlnorm
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Punycode parameters from RFC 3492, section 5.
+const (
+	base = 36
+	tMin = 1
+	tMax = 26
+	skew = 38
+	damp = 700
+	initialBias = 72
+	initialN = 128
+	acePrefix = "xn--"
+)
+
+var (
+	errPunycodeOverflow = errors.New("PunycodeOverflow")
+	errPunycodeInvalid = errors.New("InvalidPunycode")
+)
+
+// toASCII converts every non-ASCII label of the host to its "xn--" form.
+func toASCII(host string) (string, error) {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := encode(label)
+		if err != nil {
+			return "", err
+		}
+		labels[i] = acePrefix + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// toUnicode decodes every "xn--" label of the host. Labels that aren't
+// valid punycode of a non-ASCII label are kept.
+func toUnicode(host string) string {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(label, acePrefix) {
+			continue
+		}
+		if decoded, err := decode(label[len(acePrefix):]); err == nil && !isASCII(decoded) {
+			labels[i] = decoded
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+func encode(input string) (string, error) {
+	runes := []rune(input)
+	out := make([]byte, 0, len(input))
+	for _, r := range runes {
+		if r < utf8RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := initialN, 0, initialBias
+	for handled < len(runes) {
+		next := math.MaxInt32
+		for _, r := range runes {
+			if int(r) >= n && int(r) < next {
+				next = int(r)
+			}
+		}
+		if (next - n) > (math.MaxInt32 - delta) / (handled + 1) {
+			return "", errPunycodeOverflow
+		}
+		delta += (next - n) * (handled + 1)
+		n = next
+
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := base; ; k += base {
+				t := threshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, digit(t + (q - t) % (base - t)))
+				q = (q - t) / (base - t)
+			}
+			out = append(out, digit(q))
+			bias = adapt(delta, handled + 1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+func decode(input string) (string, error) {
+	out := make([]rune, 0, len(input))
+	pos := 0
+	if basic := strings.LastIndexByte(input, '-'); basic >= 0 {
+		for i := 0; i < basic; i++ {
+			if input[i] >= utf8RuneSelf {
+				return "", errPunycodeInvalid
+			}
+			out = append(out, rune(input[i]))
+		}
+		pos = basic + 1
+	}
+
+	n, i, bias := initialN, 0, initialBias
+	for pos < len(input) {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(input) {
+				return "", errPunycodeInvalid
+			}
+			d := digitValue(input[pos])
+			pos++
+			if d < 0 {
+				return "", errPunycodeInvalid
+			}
+			if d > (math.MaxInt32 - i) / w {
+				return "", errPunycodeOverflow
+			}
+			i += d * w
+			t := threshold(k, bias)
+			if d < t {
+				break
+			}
+			if w > math.MaxInt32 / (base - t) {
+				return "", errPunycodeOverflow
+			}
+			w *= base - t
+		}
+		points := len(out) + 1
+		bias = adapt(i - oldi, points, oldi == 0)
+		if i / points > math.MaxInt32 - n {
+			return "", errPunycodeOverflow
+		}
+		n += i / points
+		i %= points
+		out = slices.Insert(out, i, rune(n))
+		i++
+	}
+	return string(out), nil
+}
+
+func threshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return tMin
+	case k >= bias + tMax:
+		return tMax
+	default:
+		return k - bias
+	}
+}
+
+func adapt(delta, points int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > ((base - tMin) * tMax) / 2 {
+		delta /= base - tMin
+		k += base
+	}
+	return k + (base - tMin + 1) * delta / (delta + skew)
+}
+
+func digit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func digitValue(c byte) int {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a')
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A')
+	case c >= '0' && c <= '9':
+		return int(c - '0') + 26
+	}
+	return -1
+}
+
+const utf8RuneSelf = 0x80
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+// Package urlnorm turns user supplied links into canonical cache keys.
+//
+// A key has no scheme: "http://Example.com/", "https://example.com" and
+// "example.com" all share the key "example.com", and the prober decides which
+// scheme answers. The host is lowercased and IDN labels are converted to
+// punycode, default ports, the credentials, the fragment and the trailing
+// slash of the root path are dropped. The path and the query are kept as they
+// are.
+package urlnorm
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultPorts are the ports dropped from the keys of links with the scheme.
+// Links without a scheme drop both.
+var defaultPorts = map[string]string{
+	"http": "80",
+	"https": "443",
+}
+
+// Canonical returns the canonical key of the link.
+func Canonical(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return "", errors.New("EmptyLink")
+	}
+
+	raw := link
+	scheme := ""
+	if prefix, rest, ok := strings.Cut(link, "://"); ok {
+		scheme = strings.ToLower(prefix)
+		if scheme != "http" && scheme != "https" {
+			return "", errors.New("UnsupportedScheme: " + scheme)
+		}
+		raw = rest
+	}
+
+	parsed, err := url.Parse("http://" + raw)
+	if err != nil {
+		return "", err
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if host == "" {
+		return "", errors.New("EmptyHost")
+	}
+	host, err = toASCII(host)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := parsed.Port(); port != "" && !isDefaultPort(scheme, port) {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+
+	var key strings.Builder
+	key.WriteString(host)
+	if path := parsed.EscapedPath(); path != "/" {
+		key.WriteString(path)
+	}
+	if parsed.RawQuery != "" {
+		key.WriteByte('?')
+		key.WriteString(parsed.RawQuery)
+	}
+	return key.String(), nil
+}
+
+func isDefaultPort(scheme, port string) bool {
+	if scheme == "" {
+		return port == defaultPorts["http"] || port == defaultPorts["https"]
+	}
+	return port == defaultPorts[scheme]
+}
+
+// Key is Canonical for callers that need a key for any input: links that
+// can't be parsed are only trimmed and lowercased, so they still get a
+// stable key and an "invalid_url" check result.
+func Key(link string) string {
+	key, err := Canonical(link)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(link))
+	}
+	return key
+}
+
+// Display returns the human readable form of a canonical key: punycode
+// labels of the host are decoded and the path and query are unescaped.
+// Parts that can't be decoded are left as they are.
+func Display(key string) string {
+	authorityEnd := len(key)
+	if i := strings.IndexAny(key, "/?"); i >= 0 {
+		authorityEnd = i
+	}
+	hostStart := strings.LastIndexByte(key[:authorityEnd], '@') + 1
+	hostEnd := authorityEnd
+	if i := strings.IndexByte(key[hostStart:authorityEnd], ':'); i >= 0 {
+		hostEnd = hostStart + i
+	}
+
+	host := toUnicode(key[hostStart:hostEnd])
+	rest := key[hostEnd:]
+	if unescaped, err := url.PathUnescape(rest); err == nil && utf8.ValidString(unescaped) {
+		rest = unescaped
+	}
+	return key[:hostStart] + host + rest
+}
@@ -0,0 +1,359 @@
+// Package webhook delivers link status change events to HTTP endpoints.
+//
+// Every payload is signed with the endpoint secret: the X-Webhook-Signature
+// header carries "sha256=" and the hex HMAC-SHA256 of the X-Webhook-Timestamp
+// value, a dot and the request body.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultRetryBackoff = time.Second
+	defaultTimeout = 10 * time.Second
+	defaultWorkers = 4
+	defaultQueueSize = 1024
+	defaultLogSize = 1000
+)
+
+const (
+	HeaderEvent = "X-Webhook-Event"
+	HeaderDelivery = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+var (
+	ErrWebhookNotFound = errors.New("WebhookNotFound")
+	ErrInvalidWebhook = errors.New("InvalidWebhook")
+)
+
+type delivery struct {
+	hook models.Webhook
+	event models.StatusChangeEvent
+	record *models.WebhookDelivery
+}
+
+type Notifier struct {
+	log *slog.Logger
+	client *http.Client
+	maxAttempts int
+	backoff time.Duration
+	queue chan delivery
+	mutex sync.RWMutex
+	hooks map[string]models.Webhook
+	// deliveries is the delivery log, oldest first.
+	deliveries []*models.WebhookDelivery
+	logSize int
+	// ctx is cancelled on Shutdown and aborts requests in flight.
+	ctx context.Context
+	cancel context.CancelFunc
+	wg sync.WaitGroup
+}
+
+func NewNotifier(cfg config.WebhooksConfig, log *slog.Logger) *Notifier {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.LogSize <= 0 {
+		cfg.LogSize = defaultLogSize
+	}
+
+	notifier := &Notifier{
+		log: log,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		maxAttempts: cfg.MaxAttempts,
+		backoff: cfg.RetryBackoff,
+		queue: make(chan delivery, cfg.QueueSize),
+		hooks: make(map[string]models.Webhook, len(cfg.Endpoints)),
+		logSize: cfg.LogSize,
+	}
+	notifier.ctx, notifier.cancel = context.WithCancel(context.Background())
+	for _, endpoint := range cfg.Endpoints {
+		_, err := notifier.Register(models.Webhook{
+			URL: endpoint.URL,
+			Secret: endpoint.Secret,
+			Events: endpoint.Events,
+		})
+		if err != nil {
+			log.Error(
+				"Skipping invalid webhook",
+				slog.String("component", "webhook"),
+				slog.String("url", endpoint.URL),
+				slog.Any("error", err),
+			)
+		}
+	}
+
+	notifier.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go notifier.work()
+	}
+	return notifier
+}
+
+// Register validates and adds the webhook. The returned copy has no secret.
+func(n *Notifier) Register(hook models.Webhook) (models.Webhook, error) {
+	target, err := url.Parse(hook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return models.Webhook{}, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	for _, event := range hook.Events {
+		if event != models.EventLinkDown && event != models.EventLinkUp {
+			return models.Webhook{}, fmt.Errorf("%w: unknown event %s", ErrInvalidWebhook, event)
+		}
+	}
+
+	hook.ID = newID()
+	hook.CreatedAt = time.Now().UTC()
+	n.mutex.Lock()
+	n.hooks[hook.ID] = hook
+	n.mutex.Unlock()
+
+	hook.Secret = ""
+	return hook, nil
+}
+
+// Webhooks returns the registered webhooks without their secrets.
+func(n *Notifier) Webhooks() []models.Webhook {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	res := make([]models.Webhook, 0, len(n.hooks))
+	for _, hook := range n.hooks {
+		hook.Secret = ""
+		res = append(res, hook)
+	}
+	slices.SortFunc(res, func(a, b models.Webhook) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return res
+}
+
+func(n *Notifier) Delete(id string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if _, ok := n.hooks[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrWebhookNotFound, id)
+	}
+	delete(n.hooks, id)
+	return nil
+}
+
+// Deliveries returns up to limit entries of the delivery log, newest first.
+func(n *Notifier) Deliveries(limit int) []models.WebhookDelivery {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	if limit <= 0 || limit > len(n.deliveries) {
+		limit = len(n.deliveries)
+	}
+	res := make([]models.WebhookDelivery, 0, limit)
+	for i := len(n.deliveries) - 1; i >= 0 && len(res) < limit; i-- {
+		res = append(res, *n.deliveries[i])
+	}
+	return res
+}
+
+// Notify queues the event for every subscribed webhook. It never blocks:
+// if the queue is full the delivery is logged as dropped.
+func(n *Notifier) Notify(event models.StatusChangeEvent) {
+	if event.ID == "" {
+		event.ID = newID()
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for _, hook := range n.hooks {
+		if len(hook.Events) != 0 && !slices.Contains(hook.Events, event.Type) {
+			continue
+		}
+		record := &models.WebhookDelivery{
+			ID: newID(),
+			WebhookID: hook.ID,
+			EventID: event.ID,
+			EventType: event.Type,
+			Link: event.Link,
+			CreatedAt: time.Now().UTC(),
+		}
+		n.appendLog(record)
+
+		select {
+		case n.queue <- delivery{hook: hook, event: event, record: record}:
+		default:
+			record.Error = "QueueIsFull"
+			n.log.Error(
+				"Webhook delivery dropped",
+				slog.String("component", "webhook"),
+				slog.String("webhook", hook.ID),
+				slog.String("event", event.ID),
+			)
+		}
+	}
+}
+
+// Shutdown stops the workers. Deliveries waiting for a retry are abandoned.
+func(n *Notifier) Shutdown(ctx context.Context) error {
+	n.cancel()
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+func(n *Notifier) work() {
+	defer n.wg.Done()
+	for {
+		select {
+		case d := <-n.queue:
+			n.deliver(d)
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+func(n *Notifier) deliver(d delivery) {
+	body, err := json.Marshal(d.event)
+	if err != nil {
+		n.finish(d.record, 0, err)
+		return
+	}
+
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		statusCode, err := n.send(d, body)
+		n.mutex.Lock()
+		d.record.Attempts = attempt
+		d.record.LastAttemptAt = time.Now().UTC()
+		n.mutex.Unlock()
+		if err == nil || attempt >= n.maxAttempts {
+			n.finish(d.record, statusCode, err)
+			return
+		}
+		n.mutex.Lock()
+		d.record.StatusCode = statusCode
+		d.record.Error = err.Error()
+		n.mutex.Unlock()
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+func(n *Notifier) send(d delivery, body []byte) (int, error) {
+	request, err := http.NewRequestWithContext(n.ctx, http.MethodPost, d.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderEvent, d.event.Type)
+	request.Header.Set(HeaderDelivery, d.record.ID)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	if d.hook.Secret != "" {
+		request.Header.Set(HeaderSignature, Sign(d.hook.Secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1 << 16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("UnexpectedStatus: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func(n *Notifier) finish(record *models.WebhookDelivery, statusCode int, err error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	record.StatusCode = statusCode
+	record.Delivered = err == nil
+	record.Error = ""
+	if err != nil {
+		record.Error = err.Error()
+		n.log.Error(
+			"Webhook delivery failed",
+			slog.String("component", "webhook"),
+			slog.String("webhook", record.WebhookID),
+			slog.String("delivery", record.ID),
+			slog.Int("attempts", record.Attempts),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// appendLog adds the record to the delivery log. The caller must hold n.mutex.
+func(n *Notifier) appendLog(record *models.WebhookDelivery) {
+	if len(n.deliveries) >= n.logSize {
+		n.deliveries = slices.Delete(n.deliveries, 0, len(n.deliveries) - n.logSize + 1)
+	}
+	n.deliveries = append(n.deliveries, record)
+}
+
+// Sign returns the X-Webhook-Signature value of the payload.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
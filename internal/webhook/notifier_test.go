@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/behummble/29-11-2025/internal/config"
+	"github.com/behummble/29-11-2025/internal/models"
+)
+
+func TestNotifier_SignedDeliveryWithRetry(t *testing.T) {
+	var attempts atomic.Int32
+	delivered := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature := Sign("secret", r.Header.Get(HeaderTimestamp), body)
+		if r.Header.Get(HeaderSignature) != signature {
+			t.Errorf("Expected signature %s, got %s", signature, r.Header.Get(HeaderSignature))
+		}
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		close(delivered)
+	}))
+	defer receiver.Close()
+
+	notifier := NewNotifier(config.WebhooksConfig{
+		Endpoints: []config.WebhookEndpoint{{URL: receiver.URL, Secret: "secret"}},
+		RetryBackoff: 10 * time.Millisecond,
+	}, slog.Default())
+	defer notifier.Shutdown(context.Background())
+
+	notifier.Notify(models.StatusChangeEvent{Type: models.EventLinkDown, Link: "example.com"})
+
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the event to be delivered")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		deliveries := notifier.Deliveries(10)
+		if len(deliveries) == 1 && deliveries[0].Delivered {
+			if deliveries[0].Attempts != 2 {
+				t.Errorf("Expected 2 attempts, got %d", deliveries[0].Attempts)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected a successful delivery in the log, got %+v", notifier.Deliveries(10))
+}
+
+func TestNotifier_EventFilterAndManagement(t *testing.T) {
+	notifier := NewNotifier(config.WebhooksConfig{}, slog.Default())
+	defer notifier.Shutdown(context.Background())
+
+	if _, err := notifier.Register(models.Webhook{URL: "not a url"}); err == nil {
+		t.Error("Expected invalid URL to be rejected")
+	}
+	if _, err := notifier.Register(models.Webhook{URL: "https://example.com", Events: []string{"link.gone"}}); err == nil {
+		t.Error("Expected unknown event to be rejected")
+	}
+
+	hook, err := notifier.Register(models.Webhook{
+		URL: "https://example.com/hook",
+		Secret: "secret",
+		Events: []string{models.EventLinkUp},
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if hook.Secret != "" || notifier.Webhooks()[0].Secret != "" {
+		t.Error("Expected secret to be hidden")
+	}
+
+	notifier.Notify(models.StatusChangeEvent{Type: models.EventLinkDown, Link: "example.com"})
+	if deliveries := notifier.Deliveries(0); len(deliveries) != 0 {
+		t.Errorf("Expected no deliveries for unsubscribed event, got %d", len(deliveries))
+	}
+
+	if err := notifier.Delete(hook.ID); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if err := notifier.Delete(hook.ID); err == nil {
+		t.Error("Expected error deleting unknown webhook")
+	}
+}